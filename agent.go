@@ -2,6 +2,7 @@ package periodic
 
 import (
 	"bytes"
+	"context"
 	"github.com/Lupino/go-periodic/protocol"
 	"sync"
 )
@@ -14,13 +15,15 @@ type data struct {
 
 // Agent for client.
 type Agent struct {
-	conn    protocol.Conn
-	ID      []byte
-	locker  *sync.RWMutex
-	waiter  *sync.RWMutex
-	waiting bool
-	recived bool
-	reader  chan data
+	conn     protocol.Conn
+	ID       []byte
+	locker   *sync.RWMutex
+	waiter   *sync.RWMutex
+	waiting  bool
+	recived  bool
+	reader   chan data
+	callback func(protocol.Command, []byte, error)
+	stream   bool
 }
 
 // NewAgent create an agent.
@@ -56,12 +59,33 @@ func (a *Agent) Receive() (cmd protocol.Command, data []byte, err error) {
 	return
 }
 
+// ReceiveContext receive command or data from server until the context done.
+func (a *Agent) ReceiveContext(ctx context.Context) (cmd protocol.Command, data []byte, err error) {
+	select {
+	case dat := <-a.reader:
+		return dat.cmd, dat.data, dat.err
+	case <-ctx.Done():
+		return protocol.UNKNOWN, nil, ctx.Err()
+	}
+}
+
 // FeedCommand feed command from a connection or other.
 func (a *Agent) FeedCommand(cmd protocol.Command, dat []byte) {
+	if a.callback != nil {
+		a.callback(cmd, dat, nil)
+		return
+	}
 	a.reader <- data{cmd: cmd, data: dat, err: nil}
 }
 
 // FeedError feed error when the agent cause a error.
 func (a *Agent) FeedError(err error) {
-	a.reader <- data{cmd: protocol.UNKNOWN, data: nil, err: nil}
+	if a.callback != nil {
+		a.callback(protocol.UNKNOWN, nil, err)
+		return
+	}
+	select {
+	case a.reader <- data{cmd: protocol.UNKNOWN, data: nil, err: err}:
+	default:
+	}
 }
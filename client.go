@@ -2,13 +2,14 @@ package periodic
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/Lupino/go-periodic/protocol"
 	"github.com/Lupino/go-periodic/types"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"sort"
 	"strings"
@@ -16,42 +17,117 @@ import (
 	"time"
 )
 
-// Client defined base client.
-type Client struct {
+// connState the connection state, shared by the client and its clones, so
+// the clones see the reconnects.
+type connState struct {
 	agents      map[string]*Agent
 	conn        protocol.Conn
-	locker      *sync.RWMutex
 	alive       bool
+	connected   bool
 	agentLastId uint32
+}
+
+// Client defined base client.
+type Client struct {
+	*connState
+	locker      *sync.RWMutex
 	processTask func(string, []byte)
+	reconnected func()
+	addr        string
+	key         []byte
+	health      *health
+	observer    Observer
+	logger      Logger
+	results     ResultStore
+	progress    ProgressSource
 }
 
 // NewClient create a client.
 func NewClient() *Client {
-	return new(Client)
+	c := new(Client)
+	c.connState = new(connState)
+	c.locker = new(sync.RWMutex)
+	c.health = newHealth()
+	c.logger = DefaultLogger
+	return c
 }
 
 // initClient init the base client.
-func (c *Client) initClient(conn net.Conn, clientType protocol.ClientType) {
+func (c *Client) initClient(conn protocol.Conn) {
 	c.agents = make(map[string]*Agent)
 	c.alive = true
+	c.connected = true
 	c.agentLastId = 0
-	c.locker = new(sync.RWMutex)
-	c.conn = protocol.NewClientConn(conn)
-	c.conn.Send(clientType.Bytes())
-	c.conn.Receive()
+	c.conn = conn
+	c.health.connected()
 }
 
-// Clone clone the base client.
+// dial connect to the server and send the client type.
+func (c *Client) dial() (protocol.Conn, error) {
+	parts := strings.SplitN(c.addr, "://", 2)
+	if len(parts) != 2 {
+		return protocol.Conn{}, fmt.Errorf("Invalid address: %s", c.addr)
+	}
+	rawConn, err := net.Dial(parts[0], parts[1])
+	if err != nil {
+		return protocol.Conn{}, err
+	}
+	var conn protocol.Conn
+	if len(c.key) > 0 {
+		conn = protocol.NewClientConn(protocol.NewXORConn(rawConn, c.key))
+	} else {
+		conn = protocol.NewClientConn(rawConn)
+	}
+	if observer, ok := c.observer.(protocol.Observer); ok {
+		conn.SetObserver(observer)
+	}
+	if err := conn.Send(protocol.TYPECLIENT.Bytes()); err != nil {
+		conn.Close()
+		return protocol.Conn{}, err
+	}
+	if _, err := conn.Receive(); err != nil {
+		conn.Close()
+		return protocol.Conn{}, err
+	}
+	return conn, nil
+}
+
+// Clone clone the base client, the clone share the connection of the client.
 func (c *Client) Clone() *Client {
 	var c1 = new(Client)
-	c1.agents = c.agents
-	c1.alive = c.alive
+	c1.connState = c.connState
 	c1.locker = c.locker
-	c1.conn = c.conn
+	c1.addr = c.addr
+	c1.key = c.key
+	c1.health = c.health
+	c1.observer = c.observer
+	c1.logger = c.logger
+	c1.results = c.results
+	c1.progress = c.progress
 	return c1
 }
 
+// getConn return the current connection.
+func (c *Client) getConn() protocol.Conn {
+	c.locker.RLock()
+	defer c.locker.RUnlock()
+	return c.conn
+}
+
+// isAlive return false when the client is closed.
+func (c *Client) isAlive() bool {
+	c.locker.RLock()
+	defer c.locker.RUnlock()
+	return c.alive
+}
+
+// isConnected return true when the connection is alive.
+func (c *Client) isConnected() bool {
+	c.locker.RLock()
+	defer c.locker.RUnlock()
+	return c.connected
+}
+
 // removeAgent remove a agent by a agentID
 func (c *Client) removeAgent(agentID []byte) {
 	c.locker.Lock()
@@ -61,6 +137,13 @@ func (c *Client) removeAgent(agentID []byte) {
 
 // newAgent create a new agent with an shortid
 func (c *Client) newAgent() *Agent {
+	return c.newAgentWithCallback(nil)
+}
+
+// newAgentWithCallback create a new agent, the callback is called from the
+// receive loop with the reply instead of feeding the agent, it must not
+// block and the agent is removed after.
+func (c *Client) newAgentWithCallback(callback func(protocol.Command, []byte, error)) *Agent {
 	c.locker.Lock()
 	defer c.locker.Unlock()
 
@@ -72,13 +155,9 @@ func (c *Client) newAgent() *Agent {
 			c.agentLastId = 1
 		}
 
-		buf := new(bytes.Buffer)
-		err := binary.Write(buf, binary.BigEndian, c.agentLastId)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		agentID = string(buf.Bytes())
+		h32 := make([]byte, 4)
+		binary.BigEndian.PutUint32(h32, c.agentLastId)
+		agentID = string(h32)
 
 		_, ok := c.agents[agentID]
 		if !ok {
@@ -88,16 +167,40 @@ func (c *Client) newAgent() *Agent {
 	}
 
 	agent := NewAgent(c.conn, []byte(agentID))
+	agent.callback = callback
 	c.agents[agentID] = agent
 
 	return agent
 }
 
+// newStreamAgent create a new agent with callback, it is kept while the
+// server push the PROGRESS packets.
+func (c *Client) newStreamAgent(callback func(protocol.Command, []byte, error)) *Agent {
+	agent := c.newAgentWithCallback(callback)
+	agent.stream = true
+	return agent
+}
+
 func (c *Client) sendCommandAndReceive(cmd protocol.Command, data []byte) (protocol.Command, []byte, error) {
+	return c.sendCommandAndReceiveContext(context.Background(), cmd, data)
+}
+
+func (c *Client) sendCommandAndReceiveContext(ctx context.Context, cmd protocol.Command, data []byte) (ret protocol.Command, retData []byte, err error) {
+	if c.observer != nil {
+		start := time.Now()
+		defer func() {
+			c.observer.ObserveCommand(cmd, ret, time.Since(start), err)
+		}()
+	}
+	if !c.isConnected() {
+		return protocol.UNKNOWN, nil, ErrNotConnected
+	}
 	agent := c.newAgent()
 	defer c.removeAgent(agent.ID)
-	agent.Send(cmd, data)
-	return agent.Receive()
+	if err = agent.Send(cmd, data); err != nil {
+		return protocol.UNKNOWN, nil, err
+	}
+	return agent.ReceiveContext(ctx)
 }
 
 func (c *Client) sendCommand(cmd protocol.Command, data []byte) {
@@ -107,11 +210,14 @@ func (c *Client) sendCommand(cmd protocol.Command, data []byte) {
 }
 
 // receiveLoop a loop on receive data.
-func (c *Client) receiveLoop() {
-	for c.alive {
-		payload, err := c.conn.Receive()
+func (c *Client) receiveLoop(conn protocol.Conn) {
+	for c.isAlive() {
+		payload, err := conn.Receive()
 		if err != nil {
-			log.Fatal(err)
+			if c.isAlive() {
+				c.disconnect(err)
+			}
+			return
 		}
 		agentID, cmd, data := protocol.ParseCommand(payload)
 		if cmd == protocol.JOBASSIGN {
@@ -121,67 +227,112 @@ func (c *Client) receiveLoop() {
 		c.locker.Lock()
 		agent, ok := c.agents[string(agentID)]
 		if !ok {
-			log.Printf("Agent: %s not found.\n", agentID)
+			c.logger.Warn("agent not found", "agent", fmt.Sprintf("%x", agentID), "command", cmd.Name())
 			c.locker.Unlock()
 			continue
 		}
 		agent.FeedCommand(cmd, data)
+		if agent.callback != nil && !(agent.stream && cmd == protocol.PROGRESS) {
+			delete(c.agents, string(agentID))
+		}
 		c.locker.Unlock()
 	}
 }
 
-// checkHealth check connection health.
-func (c *Client) checkHealth() {
-	for c.alive {
-		c.Ping()
-		time.Sleep(time.Second)
+// setAddr set the server address and read the XOR key file.
+func (c *Client) setAddr(addr string, key ...string) error {
+	c.addr = addr
+	if len(key) > 0 && len(key[0]) > 0 {
+		keyBuf, err := ioutil.ReadFile(key[0])
+		if err != nil {
+			return err
+		}
+		c.key = keyBuf
 	}
+	return nil
 }
 
 // Connect a periodic server.
 func (c *Client) Connect(addr string, key ...string) error {
-	parts := strings.SplitN(addr, "://", 2)
-	conn, err := net.Dial(parts[0], parts[1])
+	if err := c.setAddr(addr, key...); err != nil {
+		return err
+	}
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
-	if len(key) > 0 && len(key[0]) > 0 {
-		if keyBuf, err := ioutil.ReadFile(key[0]); err != nil {
-			return err
-		} else {
-			c.initClient(protocol.NewXORConn(conn, keyBuf), protocol.TYPECLIENT)
-		}
-	} else {
-		c.initClient(conn, protocol.TYPECLIENT)
+	c.initClient(conn)
+	go c.receiveLoop(conn)
+	go c.checkHealth()
+	return nil
+}
+
+// connectLater connect the server in background until success,
+// the OnReconnect callback is called once connected.
+func (c *Client) connectLater(addr string, key ...string) error {
+	if err := c.setAddr(addr, key...); err != nil {
+		return err
 	}
-	go c.receiveLoop()
+	c.locker.Lock()
+	c.agents = make(map[string]*Agent)
+	c.alive = true
+	c.connected = false
+	c.locker.Unlock()
+	go c.reconnect()
 	go c.checkHealth()
 	return nil
 }
 
+// ping the server and return the round-trip latency.
+func (c *Client) ping(timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	ret, _, err := c.sendCommandAndReceiveContext(ctx, protocol.PING, nil)
+	if err == context.DeadlineExceeded {
+		return 0, ErrPingTimeout
+	}
+	if err != nil {
+		return 0, err
+	}
+	if ret != protocol.PONG {
+		return 0, ErrPingFailed
+	}
+	return time.Since(start), nil
+}
+
+// PingLatency ping a periodic server and return the round-trip latency.
+func (c *Client) PingLatency(timeout time.Duration) (time.Duration, error) {
+	return c.ping(timeout)
+}
+
 // Ping a periodic server.
 func (c *Client) Ping() bool {
-	ret, _, _ := c.sendCommandAndReceive(protocol.PING, nil)
-	if ret == protocol.PONG {
-		return true
-	}
-	return false
+	_, err := c.ping(c.health.getInterval())
+	return err == nil
 }
 
 // SubmitJob to periodic server.
+// The args is a string or []byte, compress it by periodic.Gzip or
+// periodic.Zstd for large args. The mode is one of periodic.SubmitIfAbsent
+// and periodic.SubmitReplace, ErrJobExists if the job exists with
+// SubmitIfAbsent.
 //
 //	opts = map[string]interface{}{
 //	  "schedat": schedat,
 //	  "args": args,
 //	  "timeout": timeout,
+//	  "compress": compression,
+//	  "mode": mode,
 //	}
 func (c *Client) SubmitJob(funcName, name string, opts map[string]interface{}) error {
 	job := types.Job{
 		Func: funcName,
 		Name: name,
 	}
-	if args, ok := opts["args"]; ok {
-		job.Args, _ = args.(string)
+	var err error
+	if job.Args, err = argsOf(opts); err != nil {
+		return err
 	}
 	if schedat, ok := opts["schedat"]; ok {
 		job.SchedAt, _ = schedat.(int64)
@@ -189,42 +340,146 @@ func (c *Client) SubmitJob(funcName, name string, opts map[string]interface{}) e
 	if timeout, ok := opts["timeout"]; ok {
 		job.Timeout, _ = timeout.(int32)
 	}
-	ret, data, _ := c.sendCommandAndReceive(protocol.SUBMITJOB, job.Bytes())
-	if ret == protocol.SUCCESS {
+	mode, err := submitModeOf(opts)
+	if err != nil {
+		return err
+	}
+	cmd := protocol.SUBMITJOB
+	switch mode {
+	case SubmitIfAbsent:
+		cmd = protocol.SUBMITIFABSENT
+	case SubmitReplace:
+		if err := c.RemoveJob(funcName, name); err != nil {
+			return err
+		}
+	}
+	ret, data, err := c.sendCommandAndReceive(cmd, job.Bytes())
+	if err != nil {
+		return err
+	}
+	switch {
+	case ret == protocol.SUCCESS:
 		return nil
+	case ret == protocol.JOBEXISTS:
+		return ErrJobExists
+	case ret == protocol.UNKNOWN && cmd == protocol.SUBMITIFABSENT:
+		return ErrNotSupported
 	}
 	return fmt.Errorf("SubmitJob error: %s", data)
 }
 
+// SubmitJobs submit the jobs without waiting for each reply, the requests
+// are pipelined over the connection. The jobs are submitted with
+// SubmitDefault, use SubmitJob for the other submit modes.
+// Return an error per job, nil on success.
+func (c *Client) SubmitJobs(jobs []types.Job) []error {
+	payloads := make([][]byte, len(jobs))
+	for i, job := range jobs {
+		payloads[i] = job.Bytes()
+	}
+	return c.pipeline(protocol.SUBMITJOB, payloads, "SubmitJob", pipelineWindow)
+}
+
+// pipelineWindow the default requests in flight of the pipelined commands.
+const pipelineWindow = 1024
+
+// pipeline send the command with each payload without waiting for each
+// reply, at most window requests in flight.
+// Return an error per payload, nil on SUCCESS.
+func (c *Client) pipeline(cmd protocol.Command, payloads [][]byte, name string, window int) []error {
+	type request struct {
+		agent *Agent
+		start time.Time
+	}
+	errs := make([]error, len(payloads))
+	sent := make(chan request, window)
+	inflight := make(chan struct{}, window)
+	go func() {
+		defer close(sent)
+		for i, payload := range payloads {
+			inflight <- struct{}{}
+			if !c.isConnected() {
+				errs[i] = ErrNotConnected
+				sent <- request{}
+				continue
+			}
+			agent := c.newAgent()
+			start := time.Now()
+			if err := agent.Send(cmd, payload); err != nil {
+				c.removeAgent(agent.ID)
+				errs[i] = err
+				sent <- request{}
+				continue
+			}
+			sent <- request{agent: agent, start: start}
+		}
+	}()
+	i := 0
+	for req := range sent {
+		if req.agent != nil {
+			ret, data, err := req.agent.Receive()
+			c.removeAgent(req.agent.ID)
+			if c.observer != nil {
+				c.observer.ObserveCommand(cmd, ret, time.Since(req.start), err)
+			}
+			if err == nil && ret != protocol.SUCCESS {
+				err = fmt.Errorf("%s error: %s", name, data)
+			}
+			errs[i] = err
+		}
+		<-inflight
+		i++
+	}
+	return errs
+}
+
+// ErrNoWorker error on run job while no worker can do the func
+var ErrNoWorker = errors.New("Error: no worker")
+
 // RunJob to periodic server and get an result.
+// The args is the same as SubmitJob.
 //
 //	opts = map[string]interface{}{
 //	  "args": args,
 //	  "timeout": timeout,
+//	  "compress": compression,
 //	}
 func (c *Client) RunJob(funcName, name string, opts map[string]interface{}) (err error, ret []byte) {
+	payload, err := runJobPayload(funcName, name, opts)
+	if err != nil {
+		return err, nil
+	}
+	cmd, ret, err := c.sendCommandAndReceive(protocol.RUNJOB, payload)
+	if cmd == protocol.NO_WORKER {
+		err = fmt.Errorf("%w %s", ErrNoWorker, funcName)
+	}
+	return err, ret
+}
+
+// runJobPayload encode the RunJob job.
+func runJobPayload(funcName, name string, opts map[string]interface{}) ([]byte, error) {
 	job := types.Job{
 		Func: funcName,
 		Name: name,
 	}
-	if args, ok := opts["args"]; ok {
-		job.Args, _ = args.(string)
+	var err error
+	if job.Args, err = argsOf(opts); err != nil {
+		return nil, err
 	}
 	if timeout, ok := opts["timeout"]; ok {
 		if job.Timeout, ok = timeout.(int32); !ok {
 			job.Timeout = 10
 		}
 	}
-	cmd, ret, err := c.sendCommandAndReceive(protocol.RUNJOB, job.Bytes())
-	if cmd == protocol.NO_WORKER {
-		err = fmt.Errorf("Error: no worker %s", funcName)
-	}
-	return err, ret
+	return job.Bytes(), nil
 }
 
 // Status return a status from periodic server.
 func (c *Client) Status() ([][]string, error) {
-	_, data, _ := c.sendCommandAndReceive(protocol.STATUS, nil)
+	_, data, err := c.sendCommandAndReceive(protocol.STATUS, nil)
+	if err != nil {
+		return nil, err
+	}
 	stats := strings.Split(string(data), "\n")
 	sort.Strings(stats)
 
@@ -241,33 +496,84 @@ func (c *Client) Status() ([][]string, error) {
 
 // DropFunc drop unuself function from periodic server.
 func (c *Client) DropFunc(funcName string) error {
-	ret, data, _ := c.sendCommandAndReceive(protocol.DROPFUNC, encode8(funcName))
+	ret, data, err := c.sendCommandAndReceive(protocol.DROPFUNC, encode8(funcName))
+	if err != nil {
+		return err
+	}
 	if ret == protocol.SUCCESS {
 		return nil
 	}
 	return fmt.Errorf("Drop func %s error: %s", funcName, data)
 }
 
-// RemoveJob to periodic server.
-func (c *Client) RemoveJob(funcName, name string) error {
+// Shutdown the periodic server. The server does not answer, it close the
+// connections on exit, so the client is closed after the command is sent.
+func (c *Client) Shutdown() error {
+	if !c.isConnected() {
+		return ErrNotConnected
+	}
+	agent := c.newAgent()
+	err := agent.Send(protocol.SHUTDOWN, nil)
+	c.removeAgent(agent.ID)
+	if c.observer != nil {
+		c.observer.ObserveCommand(protocol.SHUTDOWN, protocol.UNKNOWN, 0, err)
+	}
+	if err != nil {
+		return err
+	}
+	c.Close()
+	return nil
+}
+
+// encodeHandle encode the func and name to a job handle.
+func encodeHandle(funcName, name string) []byte {
 	buf := bytes.NewBuffer(nil)
 	buf.WriteByte(byte(len(funcName)))
 	buf.WriteString(funcName)
 	buf.WriteByte(byte(len(name)))
 	buf.WriteString(name)
-	ret, data, _ := c.sendCommandAndReceive(protocol.REMOVEJOB, buf.Bytes())
+	return buf.Bytes()
+}
+
+// RemoveJob to periodic server.
+func (c *Client) RemoveJob(funcName, name string) error {
+	ret, data, err := c.sendCommandAndReceive(protocol.REMOVEJOB, encodeHandle(funcName, name))
+	if err != nil {
+		return err
+	}
 	if ret == protocol.SUCCESS {
 		return nil
 	}
 	return fmt.Errorf("RemoveJob error: %s", data)
 }
 
+// RemoveJobs remove the jobs of a func without waiting for each reply,
+// the requests are pipelined over the connection, at most concurrency
+// in flight, 1024 when it is less than 1.
+// Return an error per job, nil on success.
+func (c *Client) RemoveJobs(funcName string, names []string, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = pipelineWindow
+	}
+	payloads := make([][]byte, len(names))
+	for i, name := range names {
+		payloads[i] = encodeHandle(funcName, name)
+	}
+	return c.pipeline(protocol.REMOVEJOB, payloads, "RemoveJob", concurrency)
+}
+
 // Close the base client.
 func (c *Client) Close() {
 	c.locker.Lock()
-	defer c.locker.Unlock()
 	for _, agent := range c.agents {
 		agent.FeedError(io.EOF)
 	}
 	c.alive = false
+	c.connected = false
+	conn := c.conn
+	c.locker.Unlock()
+	c.health.disconnected()
+	if conn.Conn != nil {
+		conn.Close()
+	}
 }
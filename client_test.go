@@ -0,0 +1,1385 @@
+package periodic
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic/protocol"
+	"github.com/Lupino/go-periodic/types"
+	"log"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer a minimal periodic server for tests.
+type fakeServer struct {
+	addr     string
+	listener net.Listener
+	locker   sync.Mutex
+	conns    []protocol.Conn
+	handle   func(cmd protocol.Command, data []byte) (protocol.Command, []byte)
+	grab     func(msgID []byte)
+	watch    func(msgID []byte)
+	done     func(name string)
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	sock := filepath.Join(t.TempDir(), "periodic.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{addr: "unix://" + sock, listener: listener}
+	s.handle = func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd == protocol.PING {
+			return protocol.PONG, nil
+		}
+		return protocol.SUCCESS, nil
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		rawConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := protocol.NewServerConn(rawConn)
+		s.locker.Lock()
+		s.conns = append(s.conns, conn)
+		s.locker.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeServer) serveConn(conn protocol.Conn) {
+	if _, err := conn.Receive(); err != nil {
+		return
+	}
+	conn.Send([]byte("conn"))
+	for {
+		payload, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		msgID, cmd, data := protocol.ParseCommand(payload)
+		s.locker.Lock()
+		handle := s.handle
+		grab := s.grab
+		watch := s.watch
+		done := s.done
+		s.locker.Unlock()
+		if cmd == protocol.GRABJOB {
+			if grab != nil {
+				grab(msgID)
+			}
+			continue
+		}
+		if cmd == protocol.WATCHJOB && watch != nil {
+			watch(msgID)
+			continue
+		}
+		if cmd == protocol.WORKDONE && done != nil {
+			funcSize := int(data[0])
+			nameSize := int(data[1+funcSize])
+			done(string(data[2+funcSize : 2+funcSize+nameSize]))
+		}
+		ret, retData := handle(cmd, data)
+		if ret == protocol.NOOP {
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		buf.Write(msgID)
+		buf.WriteByte(byte(ret))
+		buf.Write(retData)
+		conn.Send(buf.Bytes())
+	}
+}
+
+// setHandle replace the command handler, return NOOP to not reply.
+func (s *fakeServer) setHandle(handle func(cmd protocol.Command, data []byte) (protocol.Command, []byte)) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.handle = handle
+}
+
+// dropConns close all accepted connections.
+func (s *fakeServer) dropConns() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) Close() {
+	s.listener.Close()
+	s.dropConns()
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if !c.Ping() {
+		t.Fatal("Ping: except true, got false")
+	}
+}
+
+func TestClientShutdown(t *testing.T) {
+	s := newFakeServer(t)
+	shutdown := make(chan struct{}, 1)
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd == protocol.SHUTDOWN {
+			shutdown <- struct{}{}
+		}
+		return protocol.NOOP, nil
+	})
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, shutdown, "shutdown")
+	if err := c.Shutdown(); err != ErrNotConnected {
+		t.Fatalf("Shutdown after close: except %v, got %v", ErrNotConnected, err)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+	c.SetKeepAlive(20*time.Millisecond, 2)
+	disconnected := make(chan struct{}, 1)
+	reconnected := make(chan struct{}, 1)
+	c.OnDisconnect(func(error) { disconnected <- struct{}{} })
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	clone := c.Clone()
+	s.dropConns()
+	waitFor(t, disconnected, "disconnect")
+	waitFor(t, reconnected, "reconnect")
+	if !c.Ping() {
+		t.Fatal("Ping after reconnect: except true, got false")
+	}
+	// the clone share the connection
+	if !clone.Ping() {
+		t.Fatal("Ping the clone after reconnect: except true, got false")
+	}
+}
+
+func TestClientUnhealthy(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+	c.SetKeepAlive(20*time.Millisecond, 2)
+	unhealthy := make(chan struct{}, 1)
+	reconnected := make(chan struct{}, 1)
+	c.OnUnhealthy(func(error) { unhealthy <- struct{}{} })
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		return protocol.NOOP, nil
+	})
+	waitFor(t, unhealthy, "unhealthy")
+	if c.Healthy() {
+		t.Fatal("Healthy: except false, got true")
+	}
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		return protocol.PONG, nil
+	})
+	waitFor(t, reconnected, "reconnect")
+	if !c.Ping() {
+		t.Fatal("Ping after reconnect: except true, got false")
+	}
+	if c.Latency() <= 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if c.Latency() <= 0 {
+		t.Fatalf("Latency: except > 0, got %s", c.Latency())
+	}
+}
+
+func TestClientPool(t *testing.T) {
+	s := newFakeServer(t)
+	var submitted int32
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd == protocol.SUBMITJOB {
+			s.locker.Lock()
+			submitted++
+			s.locker.Unlock()
+		}
+		if cmd == protocol.PING {
+			return protocol.PONG, nil
+		}
+		return protocol.SUCCESS, nil
+	})
+	reconnected := make(chan struct{}, 3)
+	p := NewClientPool(3, func(c *Client) {
+		c.SetKeepAlive(20*time.Millisecond, 2)
+		c.OnReconnect(func() { reconnected <- struct{}{} })
+	})
+	if err := p.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s.locker.Lock()
+	conns := len(s.conns)
+	s.locker.Unlock()
+	if conns != 3 {
+		t.Fatalf("connections: except 3, got %d", conns)
+	}
+	for i := 0; i < 30; i++ {
+		if err := p.SubmitJob("test", "job", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.dropConns()
+	for i := 0; i < 3; i++ {
+		waitFor(t, reconnected, "reconnect")
+	}
+	if err := p.SubmitJob("test", "job", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if submitted != 31 {
+		t.Fatalf("submitted: except 31, got %d", submitted)
+	}
+}
+
+func TestClusterClient(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t), newFakeServer(t)}
+	received := make(map[string]map[string]bool)
+	var addrs []string
+	for _, s := range servers {
+		s := s
+		got := make(map[string]bool)
+		received[s.addr] = got
+		addrs = append(addrs, s.addr)
+		s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+			switch cmd {
+			case protocol.SUBMITJOB:
+				job, _ := types.NewJob(data)
+				s.locker.Lock()
+				got[job.Name] = true
+				s.locker.Unlock()
+			case protocol.STATUS:
+				return protocol.DATA, []byte("test,1,2,0,0,100\n")
+			}
+			return protocol.SUCCESS, nil
+		})
+	}
+
+	cc := NewClusterClient()
+	if err := cc.Connect(addrs); err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	for i := 0; i < 20; i++ {
+		name := "job" + strconv.Itoa(i)
+		if err := cc.SubmitJob("test", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		addr := cc.Route("test", name)[0]
+		servers[0].locker.Lock()
+		servers[1].locker.Lock()
+		if !received[addr][name] {
+			t.Errorf("job %s: except on %s", name, addr)
+		}
+		if len(received[addrs[0]])+len(received[addrs[1]]) != i+1 {
+			t.Errorf("job %s: submitted to more than one server", name)
+		}
+		servers[1].locker.Unlock()
+		servers[0].locker.Unlock()
+	}
+
+	stats, err := cc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0][1] != "2" || stats[0][2] != "4" || stats[0][5] != "100" {
+		t.Fatalf("Status: got %v", stats)
+	}
+
+	servers[0].Close()
+	for cc.clients[addrs[0]].isConnected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 20; i++ {
+		if err := cc.SubmitJob("test", "rerouted"+strconv.Itoa(i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the jobs on the down server are not removed or run on the other one
+	var owned []string
+	for i := 0; len(owned) < 3; i++ {
+		if name := "job" + strconv.Itoa(i); cc.Route("test", name)[0] == addrs[0] {
+			owned = append(owned, name)
+		}
+	}
+	if err := cc.RemoveJob("test", owned[0]); err != ErrOwnerDown {
+		t.Fatalf("RemoveJob: except %v, got %v", ErrOwnerDown, err)
+	}
+	if err, _ := cc.RunJob("test", owned[0], nil); err != ErrOwnerDown {
+		t.Fatalf("RunJob: except %v, got %v", ErrOwnerDown, err)
+	}
+	for _, err := range cc.RemoveJobs("test", owned, 0) {
+		if err != ErrOwnerDown {
+			t.Fatalf("RemoveJobs: except %v, got %v", ErrOwnerDown, err)
+		}
+	}
+	servers[1].locker.Lock()
+	defer servers[1].locker.Unlock()
+	for i := 0; i < 20; i++ {
+		if !received[addrs[1]]["rerouted"+strconv.Itoa(i)] {
+			t.Fatalf("job rerouted%d: except rerouted to %s", i, addrs[1])
+		}
+	}
+}
+
+// jobAssign send a JOBASSIGN of a job to the worker grab agent.
+func jobAssign(s *fakeServer, msgID []byte, job types.Job) {
+	s.push(msgID, protocol.JOBASSIGN, job.Bytes())
+}
+
+// push send a command to the last connection without request.
+func (s *fakeServer) push(msgID []byte, cmd protocol.Command, data []byte) {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(msgID)
+	buf.WriteByte(byte(cmd))
+	buf.Write(data)
+	s.locker.Lock()
+	conn := s.conns[len(s.conns)-1]
+	s.locker.Unlock()
+	conn.Send(buf.Bytes())
+}
+
+func TestMultiWorker(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(t), newFakeServer(t)}
+	var addrs []string
+	done := make(chan string, 10)
+	for i, s := range servers {
+		s := s
+		pending := []string{}
+		for j := 0; j < 3; j++ {
+			pending = append(pending, "job"+strconv.Itoa(i)+strconv.Itoa(j))
+		}
+		addrs = append(addrs, s.addr)
+		s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+			return protocol.SUCCESS, nil
+		})
+		s.grab = func(msgID []byte) {
+			s.locker.Lock()
+			if len(pending) == 0 {
+				s.locker.Unlock()
+				return
+			}
+			name := pending[0]
+			pending = pending[1:]
+			s.locker.Unlock()
+			go jobAssign(s, msgID, types.Job{Func: "test", Name: name})
+		}
+		s.done = func(name string) {
+			done <- s.addr + " " + name
+		}
+	}
+
+	mw := NewMultiWorker(2)
+	if err := mw.Connect(addrs); err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close()
+	if err := mw.AddFunc("test", func(job Job) {
+		job.Done()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	go mw.Work()
+
+	got := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		select {
+		case d := <-done:
+			got[d] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting jobs done, got %v", got)
+		}
+	}
+	for i, addr := range addrs {
+		for j := 0; j < 3; j++ {
+			if !got[addr+" job"+strconv.Itoa(i)+strconv.Itoa(j)] {
+				t.Fatalf("job%d%d: except done on %s, got %v", i, j, addr, got)
+			}
+		}
+	}
+}
+
+func TestSubmitJobs(t *testing.T) {
+	s := newFakeServer(t)
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		job, _ := types.NewJob(data)
+		if job.Name == "bad" {
+			return protocol.UNKNOWN, []byte("bad job")
+		}
+		return protocol.SUCCESS, nil
+	})
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var jobs []types.Job
+	for i := 0; i < 3000; i++ {
+		name := "job" + strconv.Itoa(i)
+		if i == 1500 {
+			name = "bad"
+		}
+		jobs = append(jobs, types.Job{Func: "test", Name: name})
+	}
+	errs := c.SubmitJobs(jobs)
+	if len(errs) != len(jobs) {
+		t.Fatalf("SubmitJobs: except %d results, got %d", len(jobs), len(errs))
+	}
+	for i, err := range errs {
+		if i == 1500 && err == nil {
+			t.Fatal("SubmitJobs: except error on bad job")
+		}
+		if i != 1500 && err != nil {
+			t.Fatalf("SubmitJobs: job%d: %s", i, err)
+		}
+	}
+}
+
+func TestRemoveJobs(t *testing.T) {
+	s := newFakeServer(t)
+	var locker sync.Mutex
+	removed := make(map[string]bool)
+	inflight := 0
+	c := NewClient()
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd != protocol.REMOVEJOB {
+			return protocol.SUCCESS, nil
+		}
+		// the agents of the requests waiting for the reply
+		c.locker.Lock()
+		agents := len(c.agents)
+		c.locker.Unlock()
+		locker.Lock()
+		defer locker.Unlock()
+		if agents > inflight {
+			inflight = agents
+		}
+		if string(data) == string(encodeHandle("test", "bad")) {
+			return protocol.UNKNOWN, []byte("bad job")
+		}
+		removed[string(data)] = true
+		return protocol.SUCCESS, nil
+	})
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var names []string
+	for i := 0; i < 3000; i++ {
+		name := "job" + strconv.Itoa(i)
+		if i == 1500 {
+			name = "bad"
+		}
+		names = append(names, name)
+	}
+	errs := c.RemoveJobs("test", names, 10)
+	if len(errs) != len(names) {
+		t.Fatalf("RemoveJobs: except %d results, got %d", len(names), len(errs))
+	}
+	for i, err := range errs {
+		if i == 1500 && err == nil {
+			t.Fatal("RemoveJobs: except error on bad job")
+		}
+		if i != 1500 && err != nil {
+			t.Fatalf("RemoveJobs: job%d: %s", i, err)
+		}
+	}
+	locker.Lock()
+	defer locker.Unlock()
+	if len(removed) != len(names)-1 || !removed[string(encodeHandle("test", "job2999"))] {
+		t.Fatalf("RemoveJobs: removed %d jobs", len(removed))
+	}
+	if inflight > 10 {
+		t.Fatalf("RemoveJobs: except at most 10 in flight, got %d", inflight)
+	}
+}
+
+func TestRunJobAsync(t *testing.T) {
+	s := newFakeServer(t)
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		job, _ := types.NewJob(data)
+		switch job.Func {
+		case "slow":
+			return protocol.NOOP, nil
+		case "none":
+			return protocol.NO_WORKER, nil
+		}
+		return protocol.DATA, []byte(job.Args)
+	})
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var futures []*Future
+	for i := 0; i < 100; i++ {
+		opts := map[string]interface{}{"args": strconv.Itoa(i)}
+		futures = append(futures, c.RunJobAsync(context.Background(), "test", "job", opts))
+	}
+	for i, future := range futures {
+		data, err := future.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != strconv.Itoa(i) {
+			t.Fatalf("RunJobAsync: except %d, got %s", i, data)
+		}
+	}
+
+	if _, err := c.RunJobAsync(context.Background(), "none", "job", nil).Result(); err == nil {
+		t.Fatal("RunJobAsync: except no worker error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	future := c.RunJobAsync(ctx, "slow", "job", nil)
+	if _, err := future.Result(); err != context.DeadlineExceeded {
+		t.Fatalf("RunJobAsync: except deadline exceeded, got %v", err)
+	}
+	c.locker.RLock()
+	defer c.locker.RUnlock()
+	if len(c.agents) != 0 {
+		t.Fatalf("agents: except 0, got %d", len(c.agents))
+	}
+}
+
+type typedArgs struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTypedFunc(t *testing.T) {
+	s := newFakeServer(t)
+	pending := []types.Job{
+		{Func: "typed", Name: "ok", Args: `{"id":1,"name":"a"}`},
+		{Func: "typed", Name: "invalid", Args: `{"id":`},
+		{Func: "typed", Name: "error", Args: `{"id":2}`},
+		{Func: "typed", Name: "later", Args: `{"id":3}`},
+	}
+	acks := make(chan string, 10)
+	handleName := func(data []byte) string {
+		funcSize := int(data[0])
+		nameSize := int(data[1+funcSize])
+		return string(data[2+funcSize : 2+funcSize+nameSize])
+	}
+	var submitted types.Job
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		switch cmd {
+		case protocol.SUBMITJOB:
+			submitted, _ = types.NewJob(data)
+		case protocol.WORKDONE, protocol.WORKFAIL, protocol.SCHEDLATER:
+			acks <- cmd.String() + " " + handleName(data)
+		}
+		return protocol.SUCCESS, nil
+	})
+	s.grab = func(msgID []byte) {
+		s.locker.Lock()
+		if len(pending) == 0 {
+			s.locker.Unlock()
+			return
+		}
+		job := pending[0]
+		pending = pending[1:]
+		s.locker.Unlock()
+		go jobAssign(s, msgID, job)
+	}
+
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := SubmitTyped(c, "typed", "ok", typedArgs{ID: 1, Name: "a"}, map[string]interface{}{"timeout": int32(10)}); err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Args != `{"id":1,"name":"a"}` || submitted.Timeout != 10 {
+		t.Fatalf("SubmitTyped: got %+v", submitted)
+	}
+
+	w := NewWorker(4)
+	w.SetLogger(NopLogger{})
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := AddTypedFunc(w, "typed", func(ctx context.Context, job TypedJob[typedArgs]) error {
+		switch job.Args.ID {
+		case 1:
+			if job.Args.Name != "a" {
+				return errors.New("unexpected name " + job.Args.Name)
+			}
+			return nil
+		case 3:
+			return SchedLater(10)
+		}
+		return errors.New("handler error")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	go w.Work()
+
+	got := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		select {
+		case ack := <-acks:
+			got[ack] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting jobs ack, got %v", got)
+		}
+	}
+	for _, except := range []string{"WORKDONE ok", "WORKFAIL invalid", "WORKFAIL error", "SCHEDLATER later"} {
+		if !got[except] {
+			t.Fatalf("except %s, got %v", except, got)
+		}
+	}
+}
+
+func TestCompressArgs(t *testing.T) {
+	large := bytes.Repeat([]byte{0, 1, 2, 0xff}, CompressMinSize)
+	for _, compression := range []Compression{NoCompression, Gzip, Zstd} {
+		args, err := CompressArgs(large, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compression != NoCompression && len(args) >= len(large) {
+			t.Fatalf("%s: except compressed, got %d bytes", compression, len(args))
+		}
+		data, err := DecompressArgs(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, large) {
+			t.Fatalf("%s: except the args unchanged", compression)
+		}
+	}
+	small, _ := CompressArgs([]byte("small"), Gzip)
+	if small != "small" {
+		t.Fatalf("except small args not compressed, got %q", small)
+	}
+
+	// a small payload expand over the max size, the zstd decoder is
+	// created again with the smaller max size
+	defer func(max int) {
+		DecompressMaxSize = max
+		zstdOnce = sync.Once{}
+	}(DecompressMaxSize)
+	DecompressMaxSize = 1 << 20
+	zstdOnce = sync.Once{}
+	bomb := make([]byte, DecompressMaxSize+1)
+	for _, compression := range []Compression{Gzip, Zstd} {
+		args, err := CompressArgs(bomb, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(args) > 1<<14 {
+			t.Fatalf("%s: except a small payload, got %d bytes", compression, len(args))
+		}
+		if _, err := DecompressArgs(args); !errors.Is(err, ErrArgsTooLarge) || !IsPermanent(err) {
+			t.Fatalf("%s: except permanent %v, got %v", compression, ErrArgsTooLarge, err)
+		}
+	}
+
+	s := newFakeServer(t)
+	var submitted types.Job
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd == protocol.SUBMITJOB {
+			submitted, _ = types.NewJob(data)
+		}
+		return protocol.SUCCESS, nil
+	})
+	assigned := false
+	s.grab = func(msgID []byte) {
+		s.locker.Lock()
+		defer s.locker.Unlock()
+		if assigned {
+			return
+		}
+		assigned = true
+		go jobAssign(s, msgID, submitted)
+	}
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.SubmitJob("compress", "large", map[string]interface{}{"args": large, "compress": Zstd}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(submitted.Args, zstdMarker) {
+		t.Fatal("except the submitted args compressed")
+	}
+
+	w := NewWorker(1)
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	received := make(chan []byte, 1)
+	if err := w.AddFunc("compress", func(job Job) {
+		received <- job.ArgsBytes()
+		job.Done()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	go w.Work()
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, large) {
+			t.Fatal("except the worker args decompressed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting job")
+	}
+}
+
+func TestJobWithDone(t *testing.T) {
+	var calls []string
+	job := Job{Name: "job"}.WithDone(func(job Job, data ...[]byte) error {
+		calls = append(calls, "outer")
+		return nil
+	}).WithDone(func(job Job, data ...[]byte) error {
+		calls = append(calls, "inner "+string(data[0]))
+		return job.Done(data...)
+	})
+	if err := job.Done([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "inner data,outer" {
+		t.Fatalf("except inner then outer, got %v", calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, except := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.Backoff(attempt); got != except {
+			t.Fatalf("attempt %d: except %s, got %s", attempt, except, got)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(3); got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("jitter: except in [2s, 4s], got %s", got)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	s := newFakeServer(t)
+	largeArgs := strings.Repeat("z", CompressMinSize)
+	zipped, _ := CompressArgs([]byte(largeArgs), Gzip)
+	pending := []types.Job{
+		{Func: "retry", Name: "first", Counter: 0},
+		{Func: "retry", Name: "last", Counter: 2},
+		{Func: "retry", Name: "permanent", Counter: 0},
+		{Func: "retry", Name: "classified", Counter: 0},
+		{Func: "dead", Name: "last", Counter: 2, Args: "args"},
+		{Func: "dead", Name: "zipped", Counter: 2, Args: zipped},
+		{Func: "typed", Name: "invalid", Args: "{"},
+	}
+	acks := make(chan string, 10)
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		switch cmd {
+		case protocol.SCHEDLATER:
+			handle := data[:len(data)-10]
+			delay := binary.BigEndian.Uint64(data[len(data)-10:])
+			step := binary.BigEndian.Uint16(data[len(data)-2:])
+			acks <- fmt.Sprintf("SCHEDLATER %s %d %d", handle[2+int(handle[0]):], delay, step)
+		case protocol.WORKDONE, protocol.WORKFAIL:
+			acks <- cmd.String() + " " + string(data[2+int(data[0]):])
+		case protocol.SUBMITJOB:
+			job, _ := types.NewJob(data)
+			d, _ := ParseDeadLetter(job.Args)
+			acks <- fmt.Sprintf("SUBMITJOB %s %s %s %s %d %s", job.Func, job.Name, d.Func, d.Args, d.Counter, d.Reason)
+		}
+		return protocol.SUCCESS, nil
+	})
+	s.grab = func(msgID []byte) {
+		s.locker.Lock()
+		if len(pending) == 0 {
+			s.locker.Unlock()
+			return
+		}
+		job := pending[0]
+		pending = pending[1:]
+		s.locker.Unlock()
+		go jobAssign(s, msgID, job)
+	}
+
+	errSkip := errors.New("skip")
+	w := NewWorker(1)
+	w.SetLogger(NopLogger{})
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	policy := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: 2 * time.Second,
+		Retryable: func(err error) bool {
+			return err != errSkip
+		},
+	}
+	w.SetRetryPolicy("retry", policy)
+	policy.Final = FinalDeadLetter
+	w.SetRetryPolicy("dead", policy)
+	handler := func(job Job) {
+		switch job.Name {
+		case "permanent":
+			job.FailWith(Permanent(errors.New("bad job")))
+		case "classified":
+			job.FailWith(errSkip)
+		default:
+			job.Fail()
+		}
+	}
+	w.SetRetryPolicy("typed", DeadLetterPolicy)
+	w.AddFunc("retry", handler)
+	w.AddFunc("dead", handler)
+	AddTypedFunc(w, "typed", func(ctx context.Context, job TypedJob[typedArgs]) error {
+		return nil
+	})
+	go w.Work()
+
+	for _, except := range []string{
+		"SCHEDLATER first 2 1",
+		"WORKFAIL last",
+		"WORKFAIL permanent",
+		"WORKFAIL classified",
+		"SUBMITJOB dead.dead last dead args 2 job failed",
+		"WORKDONE last",
+		"SUBMITJOB dead.dead zipped dead " + largeArgs + " 2 job failed",
+		"WORKDONE zipped",
+		"SUBMITJOB typed.dead invalid typed { 0 decode args: unexpected end of JSON input",
+		"WORKDONE invalid",
+	} {
+		select {
+		case ack := <-acks:
+			if ack != except {
+				t.Fatalf("except %s, got %s", except, ack)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting %s", except)
+		}
+	}
+}
+
+func TestResultStore(t *testing.T) {
+	fileStore, err := NewFileResultStore(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []ResultStore{NewMemoryResultStore(), fileStore} {
+		if _, err := store.Load("test", "../job"); err != ErrResultNotFound {
+			t.Fatalf("%T: except %v, got %v", store, ErrResultNotFound, err)
+		}
+		result := JobResult{Func: "test", Name: "../job", Status: ResultDone, Output: []byte{0, 1}}
+		if err := store.Save(result); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Load("test", "../job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != ResultDone || !bytes.Equal(got.Output, result.Output) {
+			t.Fatalf("%T: except %+v, got %+v", store, result, got)
+		}
+	}
+
+	s := newFakeServer(t)
+	pending := []types.Job{
+		{Func: "result", Name: "ok"},
+		{Func: "result", Name: "bad", Counter: 1},
+	}
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		return protocol.SUCCESS, nil
+	})
+	s.grab = func(msgID []byte) {
+		s.locker.Lock()
+		if len(pending) == 0 {
+			s.locker.Unlock()
+			return
+		}
+		job := pending[0]
+		pending = pending[1:]
+		s.locker.Unlock()
+		go jobAssign(s, msgID, job)
+	}
+	store := NewMemoryResultStore()
+	w := NewWorker(1)
+	w.SetLogger(NopLogger{})
+	w.SetResultStore(store)
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	finished := make(chan struct{}, 2)
+	w.AddFunc("result", func(job Job) {
+		if job.Name == "ok" {
+			job.Done([]byte("output"))
+		} else {
+			job.FailWith(errors.New("bad job"))
+		}
+		finished <- struct{}{}
+	})
+	go w.Work()
+	waitFor(t, finished, "ok")
+	waitFor(t, finished, "bad")
+
+	c := NewClient()
+	if _, err := c.JobResult("result", "ok"); err != ErrNoResultStore {
+		t.Fatalf("except %v, got %v", ErrNoResultStore, err)
+	}
+	c.SetResultStore(store)
+	ok, err := c.JobResult("result", "ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok.Status != ResultDone || string(ok.Output) != "output" || ok.StartedAt.IsZero() || ok.FinishedAt.Before(ok.StartedAt) {
+		t.Fatalf("ok: got %+v", ok)
+	}
+	bad, err := c.JobResult("result", "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad.Status != ResultFail || bad.Error != "bad job" || bad.Counter != 1 {
+		t.Fatalf("bad: got %+v", bad)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	broker := NewProgressBroker()
+	broker.Report(Progress{Func: "progress", Name: "old", Percent: 100, Status: ResultDone})
+	old, _ := broker.Watch(context.Background(), "progress", "old")
+	if p := <-old; p.Status != ResultDone {
+		t.Fatalf("old: got %+v", p)
+	}
+	if _, ok := <-old; ok {
+		t.Fatal("old: except closed")
+	}
+
+	// the worker report to the server, the server push to the watcher
+	ws := newFakeServer(t)
+	cs := newFakeServer(t)
+	watchID := make(chan []byte, 1)
+	cs.watch = func(msgID []byte) {
+		cs.push(msgID, protocol.PROGRESS, encodeProgress(append(encode8("progress"), encode8("job")...), 0, ""))
+		watchID <- msgID
+	}
+	var msgID []byte
+	ws.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		switch cmd {
+		case protocol.PROGRESS:
+			cs.push(msgID, protocol.PROGRESS, data)
+		case protocol.WORKDONE:
+			cs.push(msgID, protocol.SUCCESS, nil)
+		}
+		return protocol.SUCCESS, nil
+	})
+	pending := []types.Job{{Func: "progress", Name: "job"}}
+	ws.grab = func(id []byte) {
+		ws.locker.Lock()
+		defer ws.locker.Unlock()
+		if len(pending) > 0 {
+			go jobAssign(ws, id, pending[0])
+			pending = nil
+		}
+	}
+
+	c := NewClient()
+	c.SetLogger(NopLogger{})
+	if err := c.Connect(cs.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ch, err := c.WatchProgress(context.Background(), "progress", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgID = <-watchID
+
+	w := NewWorker(1)
+	w.SetLogger(NopLogger{})
+	if err := w.Connect(ws.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.AddFunc("progress", func(job Job) {
+		if err := job.Progress(50, "half"); err != nil {
+			t.Error(err)
+		}
+		job.Done()
+	})
+	go w.Work()
+
+	var got []string
+	for p := range ch {
+		got = append(got, fmt.Sprintf("%s/%s:%d:%s", p.Func, p.Name, p.Percent, p.Message))
+	}
+	if strings.Join(got, ",") != "progress/job:0:,progress/job:50:half" {
+		t.Fatalf("got %v", got)
+	}
+
+	// a server without the progress support
+	cs.locker.Lock()
+	cs.watch = nil
+	cs.locker.Unlock()
+	cs.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		return protocol.UNKNOWN, nil
+	})
+	if _, err := c.WatchProgress(context.Background(), "progress", "job"); err != ErrNotSupported {
+		t.Fatalf("except %v, got %v", ErrNotSupported, err)
+	}
+
+	// the progress sink
+	sw := NewWorker(1)
+	sw.SetProgressSink(broker)
+	c.SetProgressSource(broker)
+	ctx, cancel := context.WithCancel(context.Background())
+	watched, err := c.WatchProgress(ctx, "progress", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{Worker: sw, FuncName: "progress", Name: "sink"}
+	job.Progress(150, "over")
+	if p := <-watched; p.Percent != 100 || p.Message != "over" || p.Finished() {
+		t.Fatalf("sink: got %+v", p)
+	}
+	job.finish(ResultFail, nil, errors.New("bad job"))
+	if p := <-watched; p.Status != ResultFail || p.Message != "bad job" || p.Percent != 100 {
+		t.Fatalf("sink: got %+v", p)
+	}
+	if _, ok := <-watched; ok {
+		t.Fatal("sink: except closed")
+	}
+	cancel()
+	unwatched, _ := broker.Watch(ctx, "progress", "other")
+	if _, ok := <-unwatched; ok {
+		t.Fatal("canceled: except closed")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := newFakeServer(t)
+	var locker sync.Mutex
+	var timeouts []uint64
+	supported := true
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		if cmd != protocol.HEARTBEAT {
+			return protocol.SUCCESS, nil
+		}
+		locker.Lock()
+		defer locker.Unlock()
+		timeouts = append(timeouts, binary.BigEndian.Uint64(data[len(data)-8:]))
+		if !supported {
+			return protocol.UNKNOWN, nil
+		}
+		return protocol.SUCCESS, nil
+	})
+	assign := make(chan types.Job, 2)
+	assign <- types.Job{Func: "slow", Name: "job", Timeout: 10}
+	s.grab = func(msgID []byte) {
+		go func() {
+			if job, ok := <-assign; ok {
+				jobAssign(s, msgID, job)
+			}
+		}()
+	}
+	defer close(assign)
+	w := NewWorker(1)
+	w.SetLogger(NopLogger{})
+	w.SetHeartbeat(50 * time.Millisecond)
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	finished := make(chan struct{}, 2)
+	w.AddFunc("slow", func(job Job) {
+		if job.Name == "job" {
+			if err := job.ExtendTimeout(1500 * time.Millisecond); err != nil {
+				t.Error(err)
+			}
+			time.Sleep(300 * time.Millisecond)
+		} else {
+			locker.Lock()
+			supported = false
+			timeouts = nil
+			locker.Unlock()
+			time.Sleep(300 * time.Millisecond)
+			if err := job.Heartbeat(); err != ErrNotSupported {
+				t.Errorf("except %v, got %v", ErrNotSupported, err)
+			}
+		}
+		job.Done()
+		finished <- struct{}{}
+	})
+	go w.Work()
+	waitFor(t, finished, "job")
+	locker.Lock()
+	if len(timeouts) < 3 || timeouts[0] != 2 || timeouts[1] != 0 {
+		t.Fatalf("job: got heartbeats %v", timeouts)
+	}
+	locker.Unlock()
+
+	// the heartbeat stop on the server not support it
+	assign <- types.Job{Func: "slow", Name: "old"}
+	waitFor(t, finished, "old")
+	locker.Lock()
+	defer locker.Unlock()
+	if len(timeouts) != 2 {
+		t.Fatalf("old: got heartbeats %v", timeouts)
+	}
+}
+
+func TestSubmitMode(t *testing.T) {
+	if HashName("user-", []byte("args")) != HashName("user-", []byte("args")) {
+		t.Fatal("HashName: except deterministic")
+	}
+	if name := HashName("user-", []byte("args")); len(name) != 37 || name == HashName("user-", []byte("other")) {
+		t.Fatalf("HashName: got %s", name)
+	}
+
+	s := newFakeServer(t)
+	var locker sync.Mutex
+	var cmds []string
+	jobs := make(map[string]bool)
+	supported := true
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		locker.Lock()
+		defer locker.Unlock()
+		cmds = append(cmds, cmd.String())
+		switch cmd {
+		case protocol.SUBMITJOB, protocol.SUBMITIFABSENT:
+			job, _ := types.NewJob(data)
+			if cmd == protocol.SUBMITIFABSENT {
+				if !supported {
+					return protocol.UNKNOWN, nil
+				}
+				if jobs[job.Name] {
+					return protocol.JOBEXISTS, nil
+				}
+			}
+			jobs[job.Name] = true
+		case protocol.REMOVEJOB:
+			jobs[string(data[2+int(data[0]):])] = false
+		}
+		return protocol.SUCCESS, nil
+	})
+	c := NewClient()
+	if err := c.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit := func(mode interface{}) error {
+		return c.SubmitJob("test", "job", map[string]interface{}{"mode": mode})
+	}
+	if err := submit(SubmitIfAbsent); err != nil {
+		t.Fatal(err)
+	}
+	if err := submit("if-absent"); err != ErrJobExists {
+		t.Fatalf("except %v, got %v", ErrJobExists, err)
+	}
+	if err := submit(SubmitReplace); err != nil {
+		t.Fatal(err)
+	}
+	if err := submit("bad"); err == nil {
+		t.Fatal("except invalid mode error")
+	}
+	locker.Lock()
+	supported = false
+	got := strings.Join(cmds, ",")
+	locker.Unlock()
+	if got != "SUBMITIFABSENT,SUBMITIFABSENT,REMOVEJOB,SUBMITJOB" {
+		t.Fatalf("got commands %s", got)
+	}
+	if err := submit(SubmitIfAbsent); err != ErrNotSupported {
+		t.Fatalf("except %v, got %v", ErrNotSupported, err)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	s := newFakeServer(t)
+	var locker sync.Mutex
+	holders := make(map[string]map[string]bool)
+	jobs := make(map[string]bool)
+	malformed := false
+	s.setHandle(func(cmd protocol.Command, data []byte) (protocol.Command, []byte) {
+		locker.Lock()
+		defer locker.Unlock()
+		size := int(data[0])
+		name := string(data[1 : 1+size])
+		switch cmd {
+		case protocol.SUBMITJOB:
+			job, _ := types.NewJob(data)
+			jobs[string(encodeHandle(job.Func, job.Name))] = true
+		case protocol.REMOVEJOB:
+			delete(jobs, string(data))
+		case protocol.ACQUIRE:
+			if malformed {
+				return protocol.ACQUIRED, nil
+			}
+			count := int(binary.BigEndian.Uint16(data[1+size : 3+size]))
+			handle := string(data[3+size:])
+			if !jobs[handle] {
+				return protocol.UNKNOWN, []byte("job not found")
+			}
+			if holders[name] == nil {
+				holders[name] = make(map[string]bool)
+			}
+			if holders[name][handle] || len(holders[name]) < count {
+				holders[name][handle] = true
+				return protocol.ACQUIRED, []byte{1}
+			}
+			return protocol.ACQUIRED, []byte{0}
+		case protocol.RELEASE:
+			delete(holders[name], string(data[1+size:]))
+		}
+		return protocol.SUCCESS, nil
+	})
+	w := NewWorker(1)
+	if err := w.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	l1, l2 := w.Locker(), w.Locker()
+	if ok, err := l1.TryLock("lock", 1); !ok || err != nil {
+		t.Fatalf("l1: except acquired, got %v %v", ok, err)
+	}
+	if ok, err := l2.TryLock("lock", 1); ok || err != nil {
+		t.Fatalf("l2: except not acquired, got %v %v", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l2.Lock(ctx, "lock", 1); err != context.DeadlineExceeded {
+		t.Fatalf("except %v, got %v", context.DeadlineExceeded, err)
+	}
+	time.AfterFunc(30*time.Millisecond, func() { l1.Unlock("lock") })
+	if err := l2.Lock(context.Background(), "lock", 1); err != nil {
+		t.Fatal(err)
+	}
+	l2.Unlock("lock")
+
+	func() {
+		defer func() { recover() }()
+		l1.WithLock(context.Background(), "lock", 1, func() error {
+			panic("in lock")
+		})
+	}()
+	if ok, _ := l2.TryLock("lock", 1); !ok {
+		t.Fatal("except released on panic")
+	}
+	l2.Unlock("lock")
+
+	// the holder jobs are removed on close
+	l1.Close()
+	l2.Close()
+	locker.Lock()
+	if len(jobs) != 0 {
+		t.Fatalf("except the holder jobs removed, got %v", jobs)
+	}
+	locker.Unlock()
+
+	locker.Lock()
+	malformed = true
+	locker.Unlock()
+	if _, err := l1.TryLock("other", 1); err == nil {
+		t.Fatal("except invalid reply error")
+	}
+	job := Job{Worker: w, Handle: encodeHandle("test", "job")}
+	if err, ok := job.Acquire("other", 1); err == nil || ok {
+		t.Fatalf("job: except invalid reply error, got %v %v", err, ok)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, except := range map[string]Level{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warn":    LevelWarn,
+		"warning": LevelWarn,
+		"Error":   LevelError,
+	} {
+		level, err := ParseLevel(name)
+		if err != nil || level != except {
+			t.Fatalf("ParseLevel(%s): except %s, got %s %v", name, except, level, err)
+		}
+	}
+	if _, err := ParseLevel("fatal"); err == nil {
+		t.Fatal("ParseLevel: except error on unknown level")
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := NewStdLogger(log.New(buf, "", 0), LevelInfo)
+	logger.Debug("skipped")
+	logger.Info("agent not found", "agent", "01", "command", protocol.Command(200).Name())
+	logger.Warn("bad", "error", `say "hi"`, "key")
+	logger.Error("empty", "value", "")
+	except := `level=INFO msg="agent not found" agent=01 command=200
+level=WARN msg=bad error="say \"hi\"" key=MISSING
+level=ERROR msg=empty value=""
+`
+	if got := buf.String(); got != except {
+		t.Fatalf("StdLogger: except\n%sgot\n%s", except, got)
+	}
+	if name := protocol.SUBMITJOB.Name(); name != "SUBMITJOB" {
+		t.Fatalf("Command.Name: got %s", name)
+	}
+}
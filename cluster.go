@@ -0,0 +1,296 @@
+package periodic
+
+import (
+	"errors"
+	"github.com/Lupino/go-periodic/types"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var _ ClientI = new(ClusterClient)
+
+// ErrNoServer error on the cluster have no connected server
+var ErrNoServer = errors.New("No connected server")
+
+// ErrOwnerDown error on the server of an existing job is not connected
+var ErrOwnerDown = errors.New("The server of the job is not connected")
+
+// ClusterClient defined a client of several periodic servers.
+// The jobs are routed by rendezvous hashing on the func and name, so the
+// same job always go to the same server and duplicate names dedupe there.
+// When a server is down, the new jobs are submitted to the next server by
+// score until it is reconnected, RunJob and RemoveJob of its jobs fail with
+// ErrOwnerDown.
+type ClusterClient struct {
+	clients map[string]*Client
+	addrs   []string
+	setup   []func(*Client)
+}
+
+// NewClusterClient create a cluster client,
+// setup is called on each client before connect, eg. to set a logger.
+func NewClusterClient(setup ...func(*Client)) *ClusterClient {
+	return &ClusterClient{
+		clients: make(map[string]*Client),
+		setup:   setup,
+	}
+}
+
+// Connect the periodic servers. The unreachable servers are connected in
+// background, an error is returned only when none of them is reachable.
+func (cc *ClusterClient) Connect(addrs []string, key ...string) error {
+	var lastErr error
+	connected := 0
+	for _, addr := range addrs {
+		if _, ok := cc.clients[addr]; ok {
+			continue
+		}
+		c := NewClient()
+		for _, fn := range cc.setup {
+			fn(c)
+		}
+		if err := c.Connect(addr, key...); err != nil {
+			lastErr = err
+			if err := c.connectLater(addr, key...); err != nil {
+				cc.Close()
+				return err
+			}
+		} else {
+			connected++
+		}
+		cc.clients[addr] = c
+		cc.addrs = append(cc.addrs, addr)
+	}
+	if connected == 0 && lastErr != nil {
+		cc.Close()
+		return lastErr
+	}
+	return nil
+}
+
+// Clients return the clients by server address.
+func (cc *ClusterClient) Clients() map[string]*Client {
+	return cc.clients
+}
+
+// Healthy return true when one of the servers is healthy.
+func (cc *ClusterClient) Healthy() bool {
+	for _, c := range cc.clients {
+		if c.Healthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// score the rendezvous hashing weight of a server for a key.
+func score(addr, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(addr))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Route return the servers address for a job sorted by preference.
+func (cc *ClusterClient) Route(funcName, name string) []string {
+	key := funcName + "\x00" + name
+	addrs := make([]string, len(cc.addrs))
+	copy(addrs, cc.addrs)
+	sort.Slice(addrs, func(i, j int) bool {
+		return score(addrs[i], key) > score(addrs[j], key)
+	})
+	return addrs
+}
+
+// pick the connected client with the best score for a job.
+func (cc *ClusterClient) pick(funcName, name string) (*Client, error) {
+	for _, addr := range cc.Route(funcName, name) {
+		if c := cc.clients[addr]; c.isConnected() {
+			return c, nil
+		}
+	}
+	return nil, ErrNoServer
+}
+
+// owner return the client of the best score for a job, the server holding
+// the job when it is not rerouted.
+func (cc *ClusterClient) owner(funcName, name string) (*Client, error) {
+	if c := cc.clients[cc.Route(funcName, name)[0]]; c.isConnected() {
+		return c, nil
+	}
+	return nil, ErrOwnerDown
+}
+
+// Ping return true when one of the servers answer.
+func (cc *ClusterClient) Ping() bool {
+	for _, c := range cc.clients {
+		if c.isConnected() && c.Ping() {
+			return true
+		}
+	}
+	return false
+}
+
+// SubmitJob to the server of the job, see Client.SubmitJob.
+func (cc *ClusterClient) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	c, err := cc.pick(funcName, name)
+	if err != nil {
+		return err
+	}
+	return c.SubmitJob(funcName, name, opts)
+}
+
+// SubmitJobs submit each job to its server, see Client.SubmitJobs.
+func (cc *ClusterClient) SubmitJobs(jobs []types.Job) []error {
+	return cc.batch(len(jobs), func(i int) (string, string) {
+		return jobs[i].Func, jobs[i].Name
+	}, func(c *Client, indexes []int) []error {
+		batch := make([]types.Job, len(indexes))
+		for i, index := range indexes {
+			batch[i] = jobs[index]
+		}
+		return c.SubmitJobs(batch)
+	}, cc.pick)
+}
+
+// RemoveJobs remove each job from its server, see Client.RemoveJobs.
+// The concurrency is per server.
+func (cc *ClusterClient) RemoveJobs(funcName string, names []string, concurrency int) []error {
+	return cc.batch(len(names), func(i int) (string, string) {
+		return funcName, names[i]
+	}, func(c *Client, indexes []int) []error {
+		batch := make([]string, len(indexes))
+		for i, index := range indexes {
+			batch[i] = names[index]
+		}
+		return c.RemoveJobs(funcName, batch, concurrency)
+	}, cc.owner)
+}
+
+// batch group size jobs by the server of route and run each group
+// concurrently.
+func (cc *ClusterClient) batch(size int, job func(int) (string, string), run func(*Client, []int) []error, route func(string, string) (*Client, error)) []error {
+	errs := make([]error, size)
+	batches := make(map[*Client][]int)
+	for i := 0; i < size; i++ {
+		c, err := route(job(i))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		batches[c] = append(batches[c], i)
+	}
+	var wg sync.WaitGroup
+	for c, indexes := range batches {
+		wg.Add(1)
+		go func(c *Client, indexes []int) {
+			defer wg.Done()
+			for i, err := range run(c, indexes) {
+				errs[indexes[i]] = err
+			}
+		}(c, indexes)
+	}
+	wg.Wait()
+	return errs
+}
+
+// RunJob on the server of the job, see Client.RunJob.
+// It is not rerouted, ErrOwnerDown when the server is not connected.
+func (cc *ClusterClient) RunJob(funcName, name string, opts map[string]interface{}) (error, []byte) {
+	c, err := cc.owner(funcName, name)
+	if err != nil {
+		return err, nil
+	}
+	return c.RunJob(funcName, name, opts)
+}
+
+// RemoveJob from the server of the job.
+// It is not rerouted, ErrOwnerDown when the server is not connected.
+func (cc *ClusterClient) RemoveJob(funcName, name string) error {
+	c, err := cc.owner(funcName, name)
+	if err != nil {
+		return err
+	}
+	return c.RemoveJob(funcName, name)
+}
+
+// Status return the status aggregated over the connected servers,
+// the counters are summed and the sched time is the earliest one.
+func (cc *ClusterClient) Status() ([][]string, error) {
+	var lastErr error
+	answered := 0
+	funcs := make(map[string][]int64)
+	for _, addr := range cc.addrs {
+		c := cc.clients[addr]
+		if !c.isConnected() {
+			continue
+		}
+		stats, err := c.Status()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered++
+		for _, stat := range stats {
+			if len(stat) < 6 {
+				continue
+			}
+			agg, ok := funcs[stat[0]]
+			if !ok {
+				agg = make([]int64, 5)
+				funcs[stat[0]] = agg
+			}
+			for i := 1; i < 5; i++ {
+				v, _ := strconv.ParseInt(stat[i], 10, 64)
+				agg[i-1] += v
+			}
+			schedAt, _ := strconv.ParseInt(stat[5], 10, 64)
+			if schedAt > 0 && (agg[4] == 0 || schedAt < agg[4]) {
+				agg[4] = schedAt
+			}
+		}
+	}
+	if answered == 0 {
+		if lastErr == nil {
+			lastErr = ErrNoServer
+		}
+		return nil, lastErr
+	}
+	lines := make([][]string, 0, len(funcs))
+	for funcName, agg := range funcs {
+		line := []string{funcName}
+		for _, v := range agg {
+			line = append(line, strconv.FormatInt(v, 10))
+		}
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][0] < lines[j][0]
+	})
+	return lines, nil
+}
+
+// DropFunc drop the function from all the connected servers.
+func (cc *ClusterClient) DropFunc(funcName string) error {
+	var lastErr error
+	for _, addr := range cc.addrs {
+		c := cc.clients[addr]
+		if !c.isConnected() {
+			continue
+		}
+		if err := c.DropFunc(funcName); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Close all the clients.
+func (cc *ClusterClient) Close() {
+	for _, c := range cc.clients {
+		c.Close()
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"github.com/Lupino/go-periodic"
 	"github.com/Lupino/go-periodic/cmd/periodic/subcmd"
 	"github.com/urfave/cli"
@@ -28,14 +30,27 @@ func main() {
 			Usage:  "XOR Transport encode file",
 			EnvVar: "XOR_FILE",
 		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Value:  "info",
+			Usage:  "Log level: debug, info, warn or error",
+			EnvVar: "PERIODIC_LOG_LEVEL",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		level, err := periodic.ParseLevel(c.GlobalString("log-level"))
+		if err != nil {
+			return err
+		}
+		periodic.DefaultLogger = periodic.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), level)
+		return nil
 	}
 	app.Commands = []cli.Command{
 		{
 			Name:  "status",
 			Usage: "Show status",
 			Action: func(c *cli.Context) error {
-				subcmd.ShowStatus(c.GlobalString("H"), c.GlobalString("x"))
-				return nil
+				return subcmd.ShowStatus(c.GlobalString("H"), c.GlobalString("x"))
 			},
 		},
 		{
@@ -52,33 +67,75 @@ func main() {
 					Value: "",
 					Usage: "job name",
 				},
-				cli.StringFlag{
-					Name:  "args",
-					Value: "",
-					Usage: "job workload",
-				},
+				argsFlag,
+				argsFileFlag,
+				argsBase64Flag,
+				compressFlag,
 				cli.IntFlag{
 					Name:  "sched_later",
 					Value: 0,
 					Usage: "job sched_later",
 				},
+				cli.StringFlag{
+					Name:  "file",
+					Value: "",
+					Usage: "submit json lines jobs from file, - for stdin. eg: {\"func\": \"f\", \"name\": \"n\", \"args\": \"\", \"sched_later\": 0, \"timeout\": 0}",
+				},
+				cli.IntFlag{
+					Name:  "batch",
+					Value: 1000,
+					Usage: "jobs pipelined per batch with --file",
+				},
+				cli.BoolFlag{
+					Name:  "hash-name",
+					Usage: "name the job by the hash of args, -n is the name prefix",
+				},
+				cli.BoolFlag{
+					Name:  "if-absent",
+					Usage: "fail when the job exists, need the Go server",
+				},
+				cli.BoolFlag{
+					Name:  "replace",
+					Usage: "remove the existing job before submit",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				var name = c.String("n")
 				var funcName = c.String("f")
-				var opts = map[string]interface{}{
-					"args": c.String("args"),
+				if file := c.String("file"); len(file) > 0 {
+					if c.Bool("hash-name") || c.Bool("if-absent") || c.Bool("replace") {
+						return errors.New("hash-name, if-absent and replace are not allowed with file")
+					}
+					return subcmd.SubmitJobs(c.GlobalString("H"), c.GlobalString("x"), file, funcName, c.Int("batch"))
 				}
-				if len(name) == 0 || len(funcName) == 0 {
+				if (len(name) == 0 && !c.Bool("hash-name")) || len(funcName) == 0 {
 					cli.ShowCommandHelp(c, "submit")
-					log.Fatal("Job name and func is require")
+					return errors.New("Job name and func is require")
+				}
+				if c.Bool("if-absent") && c.Bool("replace") {
+					return errors.New("only one of if-absent and replace is allowed")
+				}
+				args, err := subcmd.ReadArgs(c.String("args"), c.String("args-file"), c.String("args-base64"))
+				if err != nil {
+					return err
+				}
+				if c.Bool("hash-name") {
+					name = periodic.HashName(name, args)
+				}
+				var opts = map[string]interface{}{
+					"args":     args,
+					"compress": c.String("compress"),
+				}
+				if c.Bool("if-absent") {
+					opts["mode"] = periodic.SubmitIfAbsent
+				} else if c.Bool("replace") {
+					opts["mode"] = periodic.SubmitReplace
 				}
 				delay := c.Int("sched_later")
 				var now = time.Now()
 				var schedAt = int64(now.Unix()) + int64(delay)
 				opts["schedat"] = schedAt
-				subcmd.SubmitJob(c.GlobalString("H"), c.GlobalString("x"), funcName, name, opts)
-				return nil
+				return subcmd.SubmitJob(c.GlobalString("H"), c.GlobalString("x"), funcName, name, opts)
 			},
 		},
 		{
@@ -95,36 +152,280 @@ func main() {
 					Value: "",
 					Usage: "job name",
 				},
+				cli.StringFlag{
+					Name:  "file",
+					Value: "",
+					Usage: "remove the job names from file, one per line, - for stdin",
+				},
+				cli.IntFlag{
+					Name:  "concurrency",
+					Value: 100,
+					Usage: "removals in flight with --file",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the job names with --file without removing them, the server is not checked",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				var name = c.String("n")
 				var funcName = c.String("f")
+				if file := c.String("file"); len(file) > 0 {
+					if len(funcName) == 0 {
+						cli.ShowCommandHelp(c, "remove")
+						return errors.New("func is require")
+					}
+					return subcmd.RemoveJobs(c.GlobalString("H"), c.GlobalString("x"), file, funcName, c.Int("concurrency"), c.Bool("dry-run"))
+				}
 				if len(name) == 0 || len(funcName) == 0 {
 					cli.ShowCommandHelp(c, "remove")
-					log.Fatal("Job name and func is require")
+					return errors.New("Job name and func is require")
 				}
-				subcmd.RemoveJob(c.GlobalString("H"), c.GlobalString("x"), funcName, name)
-				return nil
+				return subcmd.RemoveJob(c.GlobalString("H"), c.GlobalString("x"), funcName, name)
+			},
+		},
+		dropCommand,
+		shutdownCommand,
+		{
+			Name:  "admin",
+			Usage: "Server maintenance operations",
+			Subcommands: []cli.Command{
+				dropCommand,
+				shutdownCommand,
 			},
 		},
 		{
-			Name:  "drop",
-			Usage: "Drop func",
+			Name:  "runjob",
+			Usage: "Run job and print the result",
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "f",
 					Value: "",
 					Usage: "function name",
 				},
+				cli.StringFlag{
+					Name:  "n",
+					Value: "",
+					Usage: "job name",
+				},
+				argsFlag,
+				argsFileFlag,
+				argsBase64Flag,
+				compressFlag,
+				cli.IntFlag{
+					Name:  "timeout",
+					Value: 10,
+					Usage: "job timeout in seconds",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "raw",
+					Usage: "result format: raw, base64 or json",
+				},
 			},
 			Action: func(c *cli.Context) error {
-				Func := c.String("f")
-				if len(Func) == 0 {
-					cli.ShowCommandHelp(c, "drop")
-					log.Fatal("function name is required")
+				var name = c.String("n")
+				var funcName = c.String("f")
+				if len(name) == 0 || len(funcName) == 0 {
+					cli.ShowCommandHelp(c, "runjob")
+					return errors.New("Job name and func is require")
+				}
+				if c.Int("timeout") < 1 {
+					cli.ShowCommandHelp(c, "runjob")
+					return errors.New("timeout must be positive")
+				}
+				args, err := subcmd.ReadArgs(c.String("args"), c.String("args-file"), c.String("args-base64"))
+				if err != nil {
+					return err
+				}
+				return subcmd.RunJob(c.GlobalString("H"), c.GlobalString("x"), funcName, name, args, c.String("compress"), c.Int("timeout"), c.String("format"))
+			},
+		},
+		{
+			Name:  "ping",
+			Usage: "Ping server and show latency",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "c",
+					Value: 5,
+					Usage: "ping count",
+				},
+				cli.DurationFlag{
+					Name:  "i",
+					Value: time.Second,
+					Usage: "interval between pings",
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Value: time.Second,
+					Usage: "ping timeout",
+				},
+				cli.BoolFlag{
+					Name:  "q",
+					Usage: "only print the summary",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				count := c.Int("c")
+				if count < 1 {
+					cli.ShowCommandHelp(c, "ping")
+					return errors.New("count must be positive")
 				}
-				subcmd.DropFunc(c.GlobalString("H"), c.GlobalString("x"), Func)
-				return nil
+				return subcmd.Ping(c.GlobalString("H"), c.GlobalString("x"), count, c.Duration("i"), c.Duration("timeout"), c.Bool("q"))
+			},
+		},
+		{
+			Name:  "deadletter",
+			Usage: "Manage the dead-letter jobs",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List the dead-letter funcs",
+					Action: func(c *cli.Context) error {
+						return subcmd.ListDeadLetters(c.GlobalString("H"), c.GlobalString("x"))
+					},
+				},
+				{
+					Name:  "requeue",
+					Usage: "Submit the dead-letter jobs to their original func",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "f",
+							Value: "",
+							Usage: "original function name",
+						},
+						cli.StringFlag{
+							Name:  "dead-func",
+							Value: "",
+							Usage: "dead-letter function name, default is <func>.dead",
+						},
+						cli.IntFlag{
+							Name:  "limit",
+							Value: 0,
+							Usage: "max jobs to requeue, 0 is no limit",
+						},
+						cli.DurationFlag{
+							Name:  "wait",
+							Value: 3 * time.Second,
+							Usage: "stop when no job come in wait",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						deadFunc := c.String("dead-func")
+						if len(deadFunc) == 0 && len(c.String("f")) > 0 {
+							deadFunc = periodic.DeadLetterFunc(c.String("f"))
+						}
+						if len(deadFunc) == 0 {
+							cli.ShowCommandHelp(c, "requeue")
+							return errors.New("function name is required")
+						}
+						return subcmd.RequeueDeadLetters(c.GlobalString("H"), c.GlobalString("x"), deadFunc, c.Int("limit"), c.Duration("wait"))
+					},
+				},
+			},
+		},
+		{
+			Name:  "bench",
+			Usage: "Benchmark the server with in-process submitters and workers",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "f",
+					Value: "periodic-bench",
+					Usage: "bench function name",
+				},
+				cli.IntFlag{
+					Name:  "submitters",
+					Value: 4,
+					Usage: "submitter goroutines, one connection each",
+				},
+				cli.IntFlag{
+					Name:  "workers",
+					Value: 2,
+					Usage: "in-process workers, 0 to only submit",
+				},
+				cli.IntFlag{
+					Name:  "worker-size",
+					Value: runtime.NumCPU() * 2,
+					Usage: "handler pool size per worker",
+				},
+				cli.IntFlag{
+					Name:  "jobs",
+					Value: 10000,
+					Usage: "total jobs to submit",
+				},
+				cli.IntFlag{
+					Name:  "rate",
+					Value: 0,
+					Usage: "total jobs per second, 0 is unlimited",
+				},
+				cli.IntFlag{
+					Name:  "size",
+					Value: 64,
+					Usage: "job args size in bytes",
+				},
+				cli.DurationFlag{
+					Name:  "latency",
+					Value: 0,
+					Usage: "handler latency",
+				},
+				cli.DurationFlag{
+					Name:  "wait",
+					Value: time.Minute,
+					Usage: "max wait for the jobs to be handled",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				opts := subcmd.BenchOptions{
+					Func:       c.String("f"),
+					Submitters: c.Int("submitters"),
+					Workers:    c.Int("workers"),
+					WorkerSize: c.Int("worker-size"),
+					Jobs:       c.Int("jobs"),
+					Rate:       c.Int("rate"),
+					Size:       c.Int("size"),
+					Latency:    c.Duration("latency"),
+					Wait:       c.Duration("wait"),
+				}
+				if len(opts.Func) == 0 || opts.Submitters < 1 || opts.Jobs < 1 || opts.Workers < 0 || opts.WorkerSize < 1 {
+					cli.ShowCommandHelp(c, "bench")
+					return errors.New("func is required, submitters, jobs and worker-size must be positive")
+				}
+				return subcmd.Bench(c.GlobalString("H"), c.GlobalString("x"), opts)
+			},
+		},
+		{
+			Name:  "result",
+			Usage: "Show the result of a finished job",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "f",
+					Value: "",
+					Usage: "function name",
+				},
+				cli.StringFlag{
+					Name:  "n",
+					Value: "",
+					Usage: "job name",
+				},
+				resultDirFlag,
+				cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "result format: text, json or raw output",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var name = c.String("n")
+				var funcName = c.String("f")
+				if len(name) == 0 || len(funcName) == 0 {
+					cli.ShowCommandHelp(c, "result")
+					return errors.New("Job name and func is require")
+				}
+				if len(c.String("result-dir")) == 0 {
+					cli.ShowCommandHelp(c, "result")
+					return errors.New("result dir is required")
+				}
+				return subcmd.ShowResult(c.String("result-dir"), funcName, name, c.String("format"))
 			},
 		},
 		{
@@ -146,6 +447,12 @@ func main() {
 					Value: runtime.NumCPU() * 2,
 					Usage: "the size of goroutines. (optional)",
 				},
+				cli.DurationFlag{
+					Name:  "heartbeat",
+					Value: 0,
+					Usage: "send a heartbeat on interval while the command is running, need the Go server. (optional)",
+				},
+				resultDirFlag,
 			},
 			Action: func(c *cli.Context) error {
 				Func := c.String("f")
@@ -153,14 +460,13 @@ func main() {
 				n := c.Int("n")
 				if len(Func) == 0 {
 					cli.ShowCommandHelp(c, "run")
-					log.Fatal("function name is required")
+					return errors.New("function name is required")
 				}
 				if len(exec) == 0 {
 					cli.ShowCommandHelp(c, "run")
-					log.Fatal("command is required")
+					return errors.New("command is required")
 				}
-				subcmd.Run(c.GlobalString("H"), c.GlobalString("x"), Func, exec, n)
-				return nil
+				return subcmd.Run(c.GlobalString("H"), c.GlobalString("x"), Func, exec, n, c.String("result-dir"), c.Duration("heartbeat"))
 			},
 		},
 	}
@@ -169,5 +475,73 @@ func main() {
 		return nil
 	}
 
-	app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+var argsFlag = cli.StringFlag{
+	Name:  "args",
+	Value: "",
+	Usage: "job workload",
+}
+
+var argsFileFlag = cli.StringFlag{
+	Name:  "args-file",
+	Value: "",
+	Usage: "read the binary job workload from file, - for stdin",
+}
+
+var argsBase64Flag = cli.StringFlag{
+	Name:  "args-base64",
+	Value: "",
+	Usage: "base64 encoded binary job workload",
+}
+
+var compressFlag = cli.StringFlag{
+	Name:  "compress",
+	Value: "none",
+	Usage: "compress the large job workload: none, gzip or zstd",
+}
+
+var resultDirFlag = cli.StringFlag{
+	Name:   "result-dir",
+	Value:  "",
+	Usage:  "the job results directory",
+	EnvVar: "PERIODIC_RESULT_DIR",
+}
+
+var dropCommand = cli.Command{
+	Name:  "drop",
+	Usage: "Drop func",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "f",
+			Value: "",
+			Usage: "function name",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		Func := c.String("f")
+		if len(Func) == 0 {
+			cli.ShowCommandHelp(c, "drop")
+			return errors.New("function name is required")
+		}
+		return subcmd.DropFunc(c.GlobalString("H"), c.GlobalString("x"), Func)
+	},
+}
+
+var shutdownCommand = cli.Command{
+	Name:  "shutdown",
+	Usage: "Shutdown the server",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "yes",
+			Usage: "do not ask for confirmation",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		return subcmd.Shutdown(c.GlobalString("H"), c.GlobalString("x"), c.Bool("yes"))
+	},
 }
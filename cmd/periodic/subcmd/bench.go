@@ -0,0 +1,196 @@
+package subcmd
+
+import (
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchOptions the bench config
+type BenchOptions struct {
+	Func       string        // the bench function name
+	Submitters int           // submitter goroutines, one client each
+	Workers    int           // in-process workers
+	WorkerSize int           // handler pool size per worker
+	Jobs       int           // total jobs to submit
+	Rate       int           // total jobs per second, 0 is unlimited
+	Size       int           // job args size in bytes
+	Latency    time.Duration // handler latency
+	Wait       time.Duration // max wait for the jobs to be handled
+}
+
+// benchStats collect the bench results
+type benchStats struct {
+	locker       sync.Mutex
+	submitted    int
+	submitErrors int
+	submitLat    latencies
+	handled      int
+	doneErrors   int
+	endToEndLat  latencies
+	allHandled   chan struct{}
+	expected     int // set once the submitters are finished, -1 before
+	allHandledOk bool
+}
+
+func (s *benchStats) submit(latency time.Duration, err error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if err != nil {
+		s.submitErrors++
+		return
+	}
+	s.submitted++
+	s.submitLat = append(s.submitLat, latency)
+}
+
+func (s *benchStats) handle(latency time.Duration, err error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.handled++
+	if err != nil {
+		s.doneErrors++
+	} else {
+		s.endToEndLat = append(s.endToEndLat, latency)
+	}
+	if !s.allHandledOk && s.expected >= 0 && s.handled >= s.expected {
+		s.allHandledOk = true
+		close(s.allHandled)
+	}
+}
+
+// benchArgs encode the run id and the submit time, pad the args to size.
+func benchArgs(run string, size int) string {
+	args := run + ":" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	if len(args) < size {
+		args += strings.Repeat("x", size-len(args))
+	}
+	return args
+}
+
+// benchSubmitTime decode the run id and the submit time of the args.
+func benchSubmitTime(args string) (string, time.Time, error) {
+	parts := strings.SplitN(args, ":", 3)
+	if len(parts) < 3 {
+		return "", time.Time{}, fmt.Errorf("invalid bench args")
+	}
+	ns, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return parts[0], time.Unix(0, ns), nil
+}
+
+// Bench cli bench, run submitters and workers against the server and print
+// the throughput, latency and errors.
+func Bench(entryPoint, xor string, opts BenchOptions) error {
+	stats := &benchStats{allHandled: make(chan struct{}), expected: -1}
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	workers := make([]*periodic.Worker, opts.Workers)
+	for i := range workers {
+		w := periodic.NewWorker(opts.WorkerSize)
+		if err := w.Connect(entryPoint, xor); err != nil {
+			return err
+		}
+		defer w.Close()
+		if err := w.AddFunc(opts.Func, func(job periodic.Job) {
+			if opts.Latency > 0 {
+				time.Sleep(opts.Latency)
+			}
+			jobRun, submitAt, err := benchSubmitTime(job.Args)
+			if err != nil {
+				job.Fail()
+				return
+			}
+			err = job.Done()
+			// the jobs left by a previous run are not counted
+			if jobRun == run {
+				stats.handle(time.Since(submitAt), err)
+			}
+		}); err != nil {
+			return err
+		}
+		workers[i] = w
+	}
+	for _, w := range workers {
+		go w.Work()
+	}
+
+	var wg sync.WaitGroup
+	perSubmitter := opts.Jobs / opts.Submitters
+	start := time.Now()
+	for i := 0; i < opts.Submitters; i++ {
+		count := perSubmitter
+		if i < opts.Jobs%opts.Submitters {
+			count++
+		}
+		c := periodic.NewClient()
+		if err := c.Connect(entryPoint, xor); err != nil {
+			return err
+		}
+		defer c.Close()
+		wg.Add(1)
+		go func(id, count int, c *periodic.Client) {
+			defer wg.Done()
+			var tick <-chan time.Time
+			if opts.Rate > 0 {
+				interval := time.Duration(int64(time.Second) * int64(opts.Submitters) / int64(opts.Rate))
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				tick = ticker.C
+			}
+			for j := 0; j < count; j++ {
+				if tick != nil {
+					<-tick
+				}
+				name := fmt.Sprintf("bench-%s-%d-%d", run, id, j)
+				submitStart := time.Now()
+				err := c.SubmitJob(opts.Func, name, map[string]interface{}{
+					"args":    benchArgs(run, opts.Size),
+					"schedat": submitStart.Unix(),
+				})
+				stats.submit(time.Since(submitStart), err)
+			}
+		}(i, count, c)
+	}
+	wg.Wait()
+	submitElapsed := time.Since(start)
+
+	stats.locker.Lock()
+	stats.expected = stats.submitted
+	if opts.Workers == 0 || stats.handled >= stats.expected {
+		stats.allHandledOk = true
+		close(stats.allHandled)
+	}
+	stats.locker.Unlock()
+
+	select {
+	case <-stats.allHandled:
+	case <-time.After(opts.Wait):
+	}
+	elapsed := time.Since(start)
+
+	stats.locker.Lock()
+	defer stats.locker.Unlock()
+	fmt.Printf("submit:  %d jobs in %s, %.1f jobs/s, %d errors\n",
+		stats.submitted, submitElapsed.Round(time.Millisecond), float64(stats.submitted)/submitElapsed.Seconds(), stats.submitErrors)
+	if len(stats.submitLat) > 0 {
+		fmt.Printf("         latency %s\n", stats.submitLat)
+	}
+	if opts.Workers == 0 {
+		return nil
+	}
+	fmt.Printf("handle:  %d jobs in %s, %.1f jobs/s, %d errors, %d not handled\n",
+		stats.handled, elapsed.Round(time.Millisecond), float64(stats.handled)/elapsed.Seconds(), stats.doneErrors, stats.submitted-stats.handled)
+	if len(stats.endToEndLat) > 0 {
+		fmt.Printf("         end-to-end latency %s\n", stats.endToEndLat)
+	}
+	if stats.submitErrors > 0 || stats.doneErrors > 0 || stats.handled < stats.submitted {
+		return fmt.Errorf("bench finished with errors")
+	}
+	return nil
+}
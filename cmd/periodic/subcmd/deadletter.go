@@ -0,0 +1,121 @@
+package subcmd
+
+import (
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"github.com/gosuri/uitable"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListDeadLetters cli deadletter list, show the dead-letter funcs.
+func ListDeadLetters(entryPoint, xor string) error {
+	c := periodic.NewClient()
+	if err := c.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer c.Close()
+	stats, err := c.Status()
+	if err != nil {
+		return err
+	}
+	table := uitable.New()
+	table.MaxColWidth = 50
+
+	table.AddRow("DEAD FUNCTION", "FUNCTION", "JOBS", "SCHEDAT")
+	for _, stat := range stats {
+		if len(stat) < 6 || !periodic.IsDeadLetterFunc(stat[0]) {
+			continue
+		}
+		ut, _ := strconv.ParseInt(stat[5], 10, 0)
+		t := time.Unix(ut, 0)
+		table.AddRow(stat[0], strings.TrimSuffix(stat[0], periodic.DeadLetterFunc("")), stat[2], t.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println(table)
+	return nil
+}
+
+// RequeueDeadLetters cli deadletter requeue, grab the jobs of the
+// dead-letter func and submit them to their original func. It stop after
+// limit jobs, 0 is no limit, or when no job come in wait.
+func RequeueDeadLetters(entryPoint, xor, deadFunc string, limit int, wait time.Duration) error {
+	w := periodic.NewWorker(1)
+	if err := w.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var locker sync.Mutex
+	requeued, failed := 0, 0
+	failedJobs := make(map[string]bool)
+	activity := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	var finish sync.Once
+
+	if err := w.AddFunc(deadFunc, func(job periodic.Job) {
+		locker.Lock()
+		defer locker.Unlock()
+		if limit > 0 && requeued >= limit {
+			// give back the jobs grabbed over the limit
+			job.SchedLater(0)
+			return
+		}
+		if failedJobs[job.Name] {
+			job.SchedLater(60)
+			return
+		}
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+		d, err := periodic.ParseDeadLetter(job.Args)
+		if err == nil {
+			err = d.Requeue(w)
+		}
+		if err != nil {
+			failed++
+			failedJobs[job.Name] = true
+			fmt.Fprintf(os.Stderr, "Requeue Job[%s] error: %s\n", job.Name, err)
+			// keep it away from this run
+			job.SchedLater(60)
+			return
+		}
+		job.Done()
+		requeued++
+		fmt.Printf("Requeue Job[%s] to Func[%s], failed by: %s\n", d.Name, d.Func, d.Reason)
+		if limit > 0 && requeued >= limit {
+			finish.Do(func() { close(finished) })
+		}
+	}); err != nil {
+		return err
+	}
+	go w.Work()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for running := true; running; {
+		select {
+		case <-activity:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(wait)
+		case <-finished:
+			running = false
+		case <-timer.C:
+			running = false
+		}
+	}
+	w.RemoveFunc(deadFunc)
+
+	locker.Lock()
+	defer locker.Unlock()
+	fmt.Printf("Requeue %d jobs, %d failed.\n", requeued, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d jobs not requeued", failed)
+	}
+	return nil
+}
@@ -1,18 +1,20 @@
 package subcmd
 
 import (
+	"fmt"
 	"github.com/Lupino/go-periodic"
-	"log"
 )
 
 // DropFunc cli drop
-func DropFunc(entryPoint, xor, funcName string) {
+func DropFunc(entryPoint, xor, funcName string) error {
 	c := periodic.NewClient()
 	if err := c.Connect(entryPoint, xor); err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer c.Close()
 	if err := c.DropFunc(funcName); err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Drop Func[%s] success.\n", funcName)
+	fmt.Printf("Drop Func[%s] success.\n", funcName)
+	return nil
 }
@@ -0,0 +1,42 @@
+package subcmd
+
+import (
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"time"
+)
+
+// Ping cli ping, ping count times and print the latency stats.
+func Ping(entryPoint, xor string, count int, interval, timeout time.Duration, quiet bool) error {
+	c := periodic.NewClient()
+	if err := c.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var samples latencies
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		latency, err := c.PingLatency(timeout)
+		if err != nil {
+			if !quiet {
+				fmt.Printf("seq=%d error: %s\n", i, err)
+			}
+			continue
+		}
+		samples = append(samples, latency)
+		if !quiet {
+			fmt.Printf("pong from %s: seq=%d time=%s\n", entryPoint, i, latency)
+		}
+	}
+
+	loss := float64(count-len(samples)) / float64(count) * 100
+	fmt.Printf("%d sent, %d received, %.1f%% loss\n", count, len(samples), loss)
+	if len(samples) == 0 {
+		return fmt.Errorf("%s unreachable", entryPoint)
+	}
+	fmt.Println(samples)
+	return nil
+}
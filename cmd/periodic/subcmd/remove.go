@@ -1,18 +1,103 @@
 package subcmd
 
 import (
+	"bufio"
+	"fmt"
 	"github.com/Lupino/go-periodic"
-	"log"
+	"os"
+	"strings"
 )
 
 // RemoveJob cli remove
-func RemoveJob(entryPoint, xor, funcName, name string) {
+func RemoveJob(entryPoint, xor, funcName, name string) error {
 	c := periodic.NewClient()
 	if err := c.Connect(entryPoint, xor); err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer c.Close()
 	if err := c.RemoveJob(funcName, name); err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Remove Job[%s] success.\n", name)
+	fmt.Printf("Remove Job[%s] success.\n", name)
+	return nil
+}
+
+// removeBatch the job names read before they are removed.
+const removeBatch = 10000
+
+// RemoveJobs cli remove --file, stream the job names from a file or stdin,
+// one per line, and remove them with concurrency removals in flight.
+// The dry run only print the names, it does not check the jobs exist on the
+// server.
+func RemoveJobs(entryPoint, xor, path, funcName string, concurrency int, dryRun bool) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	var c *periodic.Client
+	if !dryRun {
+		c = periodic.NewClient()
+		if err := c.Connect(entryPoint, xor); err != nil {
+			return err
+		}
+		defer c.Close()
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	batchSize := removeBatch
+	if concurrency > batchSize {
+		batchSize = concurrency
+	}
+
+	var success, failed int
+	var names []string
+
+	flush := func() {
+		if dryRun {
+			for _, name := range names {
+				fmt.Printf("Would remove Job[%s].\n", name)
+			}
+			success += len(names)
+		} else {
+			for i, err := range c.RemoveJobs(funcName, names, concurrency) {
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "Remove Job[%s] error: %s\n", names[i], err)
+				} else {
+					success++
+				}
+			}
+		}
+		names = names[:0]
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+		if len(names) >= batchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	flush()
+
+	if dryRun {
+		fmt.Printf("Remove Jobs: %d would be removed (dry run).\n", success)
+		return nil
+	}
+	fmt.Printf("Remove Jobs: %d success, %d failed.\n", success, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d jobs failed", failed)
+	}
+	return nil
 }
@@ -0,0 +1,42 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"os"
+	"time"
+)
+
+// ShowResult cli result, print the job result of the file result store with
+// the format: text, json or raw output.
+func ShowResult(dir, funcName, name, format string) error {
+	store, err := periodic.NewFileResultStore(dir)
+	if err != nil {
+		return err
+	}
+	result, err := store.Load(funcName, name)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		fmt.Printf("Func:     %s\n", result.Func)
+		fmt.Printf("Name:     %s\n", result.Name)
+		fmt.Printf("Status:   %s\n", result.Status)
+		fmt.Printf("Counter:  %d\n", result.Counter)
+		fmt.Printf("Started:  %s\n", result.StartedAt.Format(time.RFC3339))
+		fmt.Printf("Finished: %s\n", result.FinishedAt.Format(time.RFC3339))
+		if result.Error != "" {
+			fmt.Printf("Error:    %s\n", result.Error)
+		}
+		fmt.Printf("Output:   %s\n", result.Output)
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(result)
+	case "raw":
+		_, err = os.Stdout.Write(result.Output)
+	default:
+		err = fmt.Errorf("Unknow format %s", format)
+	}
+	return err
+}
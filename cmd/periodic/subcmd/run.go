@@ -4,28 +4,38 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/Lupino/go-periodic"
-	"io"
-	"log"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// Run cli run
-func Run(entryPoint, xor, funcName, cmd string, n int) {
+// Run cli run, the job results are saved in resultDir when it is set and
+// a heartbeat is sent on heartbeat while the command is running.
+func Run(entryPoint, xor, funcName, cmd string, n int, resultDir string, heartbeat time.Duration) error {
 	w := periodic.NewWorker(n)
+	w.SetHeartbeat(heartbeat)
+	if resultDir != "" {
+		store, err := periodic.NewFileResultStore(resultDir)
+		if err != nil {
+			return err
+		}
+		w.SetResultStore(store)
+	}
 	if err := w.Connect(entryPoint, xor); err != nil {
-		log.Fatalf("Error: %s\n", err.Error())
+		return err
 	}
-	w.AddFunc(funcName, func(job periodic.Job) {
+	if err := w.AddFunc(funcName, func(job periodic.Job) {
 		handleWorker(job, cmd)
-	})
+	}); err != nil {
+		return err
+	}
 	w.Work()
+	return nil
 }
 
 func handleWorker(job periodic.Job, cmd string) {
-	var err error
 	realCmd := strings.Split(cmd, " ")
 	realCmd = append(realCmd, job.Name)
 	c := exec.Command(realCmd[0], realCmd[1:]...)
@@ -33,13 +43,18 @@ func handleWorker(job periodic.Job, cmd string) {
 	var out bytes.Buffer
 	c.Stdout = &out
 	c.Stderr = os.Stderr
-	err = c.Run()
+	runErr := c.Run()
 	var schedLater int
 	var fail = false
-	var line string
+	var output bytes.Buffer
 	for {
-		line, err = out.ReadString([]byte("\n")[0])
+		line, err := out.ReadString([]byte("\n")[0])
 		if err != nil {
+			// the last line without newline
+			if line != "" {
+				fmt.Println(line)
+				output.WriteString(line)
+			}
 			break
 		}
 		if strings.HasPrefix(line, "SCHEDLATER") {
@@ -50,14 +65,17 @@ func handleWorker(job periodic.Job, cmd string) {
 			fail = true
 		} else {
 			fmt.Print(line)
+			output.WriteString(line)
 		}
 	}
 
-	if (err != nil && err != io.EOF) || fail {
+	if runErr != nil {
+		job.FailWith(runErr)
+	} else if fail {
 		job.Fail()
 	} else if schedLater > 0 {
 		job.SchedLater(schedLater)
 	} else {
-		job.Done()
+		job.Done(output.Bytes())
 	}
 }
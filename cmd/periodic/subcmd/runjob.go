@@ -0,0 +1,63 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"github.com/urfave/cli"
+	"os"
+	"time"
+)
+
+const (
+	// ExitNoWorker exit code on no worker can do the func
+	ExitNoWorker = 2
+	// ExitTimeout exit code on the job not finished in time
+	ExitTimeout = 3
+)
+
+// RunJob cli runjob, print the job result with the format: raw, base64 or json.
+func RunJob(entryPoint, xor, funcName, name string, args []byte, compress string, timeout int, format string) error {
+	c := periodic.NewClient()
+	if err := c.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	opts := map[string]interface{}{
+		"args":     args,
+		"timeout":  int32(timeout),
+		"compress": compress,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	data, err := c.RunJobContext(ctx, funcName, name, opts)
+	if errors.Is(err, periodic.ErrNoWorker) {
+		return cli.NewExitError(err.Error(), ExitNoWorker)
+	}
+	if err == context.DeadlineExceeded {
+		return cli.NewExitError(fmt.Sprintf("Error: run job %s timeout after %ds", name, timeout), ExitTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "raw":
+		_, err = os.Stdout.Write(data)
+	case "base64":
+		_, err = fmt.Println(base64.StdEncoding.EncodeToString(data))
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"func": funcName,
+			"name": name,
+			"data": string(data),
+		})
+	default:
+		err = fmt.Errorf("Unknow format %s", format)
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package subcmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"os"
+	"strings"
+)
+
+// confirm ask a yes or no question on stdin, default is no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Shutdown cli shutdown, ask for a confirmation unless yes is set.
+func Shutdown(entryPoint, xor string, yes bool) error {
+	if !yes && !confirm(fmt.Sprintf("Shutdown the periodic server %s?", entryPoint)) {
+		return errors.New("shutdown aborted")
+	}
+	c := periodic.NewClient()
+	if err := c.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Shutdown(); err != nil {
+		return err
+	}
+	fmt.Printf("Shutdown %s success.\n", entryPoint)
+	return nil
+}
@@ -0,0 +1,45 @@
+package subcmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// latencies a list of latency samples
+type latencies []time.Duration
+
+// percentile return the p (0-100) percentile by nearest rank.
+func (l latencies) percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	sorted := make(latencies, len(l))
+	copy(sorted, l)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (l latencies) avg() time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range l {
+		sum += d
+	}
+	return sum / time.Duration(len(l))
+}
+
+// String format min/avg/p50/p99/max
+func (l latencies) String() string {
+	return fmt.Sprintf("min/avg/p50/p99/max = %s/%s/%s/%s/%s",
+		l.percentile(0), l.avg(), l.percentile(50), l.percentile(99), l.percentile(100))
+}
@@ -4,18 +4,21 @@ import (
 	"fmt"
 	"github.com/Lupino/go-periodic"
 	"github.com/gosuri/uitable"
-	"log"
 	"strconv"
 	"time"
 )
 
 // ShowStatus cli status
-func ShowStatus(entryPoint, xor string) {
+func ShowStatus(entryPoint, xor string) error {
 	c := periodic.NewClient()
 	if err := c.Connect(entryPoint, xor); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer c.Close()
+	stats, err := c.Status()
+	if err != nil {
+		return err
 	}
-	stats, _ := c.Status()
 	table := uitable.New()
 	table.MaxColWidth = 50
 
@@ -26,4 +29,5 @@ func ShowStatus(entryPoint, xor string) {
 		table.AddRow(stat[0], stat[1], stat[2], stat[3], stat[4], t.Format("2006-01-02 15:04:05"))
 	}
 	fmt.Println(table)
+	return nil
 }
@@ -1,18 +1,178 @@
 package subcmd
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Lupino/go-periodic"
-	"log"
+	"github.com/Lupino/go-periodic/types"
+	"io"
+	"os"
+	"time"
 )
 
 // SubmitJob cli submit
-func SubmitJob(entryPoint, xor, funcName, name string, opts map[string]interface{}) {
+func SubmitJob(entryPoint, xor, funcName, name string, opts map[string]interface{}) error {
 	c := periodic.NewClient()
 	if err := c.Connect(entryPoint, xor); err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer c.Close()
 	if err := c.SubmitJob(funcName, name, opts); err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Submit Job[%s] success.\n", name)
+	fmt.Printf("Submit Job[%s] success.\n", name)
+	return nil
+}
+
+// ReadArgs read the job args from one of args, args file (- for stdin) or
+// base64 args.
+func ReadArgs(args, argsFile, argsBase64 string) ([]byte, error) {
+	set := 0
+	for _, v := range []string{args, argsFile, argsBase64} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of args, args-file and args-base64 is allowed")
+	}
+	if argsFile != "" {
+		input, err := openInput(argsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer input.Close()
+		return io.ReadAll(input)
+	}
+	if argsBase64 != "" {
+		return base64.StdEncoding.DecodeString(argsBase64)
+	}
+	return []byte(args), nil
+}
+
+// jobLine a job line of the submit file
+type jobLine struct {
+	Func       string `json:"func"`
+	Name       string `json:"name"`
+	Args       string `json:"args"`
+	ArgsBase64 string `json:"args_base64"`
+	SchedAt    int64  `json:"sched_at"`
+	SchedLater int64  `json:"sched_later"`
+	Timeout    int32  `json:"timeout"`
+}
+
+// openInput open a file, or stdin on "-"
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// SubmitJobs cli submit --file, stream the json lines jobs from a file or
+// stdin and submit them by batch.
+func SubmitJobs(entryPoint, xor, path, funcName string, batchSize int) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	c := periodic.NewClient()
+	if err := c.Connect(entryPoint, xor); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if batchSize < 1 {
+		batchSize = 1000
+	}
+
+	var success, failed int
+	var jobs []types.Job
+	var lines []int
+
+	flush := func() {
+		for i, err := range c.SubmitJobs(jobs) {
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "line %d: Submit Job[%s] error: %s\n", lines[i], jobs[i].Name, err)
+			} else {
+				success++
+			}
+		}
+		jobs = jobs[:0]
+		lines = lines[:0]
+	}
+
+	reader := bufio.NewReader(input)
+	lineno := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineno++
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if job, err := parseJobLine(line, funcName); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "line %d: %s\n", lineno, err)
+			} else {
+				jobs = append(jobs, job)
+				lines = append(lines, lineno)
+			}
+			if len(jobs) >= batchSize {
+				flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	flush()
+
+	fmt.Printf("Submit Jobs: %d success, %d failed.\n", success, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d jobs failed", failed)
+	}
+	return nil
+}
+
+// parseJobLine parse a json line to a job.
+func parseJobLine(line []byte, funcName string) (job types.Job, err error) {
+	var jl jobLine
+	if err = json.Unmarshal(line, &jl); err != nil {
+		return
+	}
+	if jl.Func == "" {
+		jl.Func = funcName
+	}
+	if jl.Func == "" || jl.Name == "" {
+		err = errors.New("job name and func is require")
+		return
+	}
+	job = types.Job{
+		Func:    jl.Func,
+		Name:    jl.Name,
+		Args:    jl.Args,
+		SchedAt: jl.SchedAt,
+		Timeout: jl.Timeout,
+	}
+	if jl.ArgsBase64 != "" {
+		var args []byte
+		if args, err = base64.StdEncoding.DecodeString(jl.ArgsBase64); err != nil {
+			return
+		}
+		job.Args = string(args)
+	}
+	if job.SchedAt == 0 {
+		job.SchedAt = time.Now().Unix() + jl.SchedLater
+	}
+	return
 }
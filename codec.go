@@ -0,0 +1,138 @@
+package periodic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec defined the encoding of the typed job args, implement it for
+// protobuf, msgpack or any other format.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encode the job args as json.
+type JSONCodec struct{}
+
+// Marshal encode v as json.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decode the json data to v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// DefaultCodec the codec used when none is given.
+var DefaultCodec Codec = JSONCodec{}
+
+func codecOf(codec []Codec) Codec {
+	if len(codec) > 0 && codec[0] != nil {
+		return codec[0]
+	}
+	return DefaultCodec
+}
+
+// WorkerI defined the workers a typed func can be added to.
+type WorkerI interface {
+	AddFunc(string, func(Job)) error
+	Broadcast(string, func(Job)) error
+	RemoveFunc(string) error
+}
+
+var _ WorkerI = new(Worker)
+var _ WorkerI = new(MultiWorker)
+
+// TypedJob defined a job with the args decoded, the raw args are still
+// in job.Job.Args.
+type TypedJob[T any] struct {
+	Job
+	Args T
+}
+
+// SchedLaterError returned by a typed handler to sched the job later.
+type SchedLaterError struct {
+	Delay   int
+	Counter int
+}
+
+func (e *SchedLaterError) Error() string {
+	return fmt.Sprintf("sched later on %d", e.Delay)
+}
+
+// SchedLater return an error tell the typed handler to sched the job later
+// on delay, see Job.SchedLater.
+func SchedLater(delay int, counter ...int) error {
+	err := &SchedLaterError{Delay: delay}
+	if len(counter) > 0 {
+		err.Counter = counter[0]
+	}
+	return err
+}
+
+// EncodeArgs encode v to job args.
+func EncodeArgs(v interface{}, codec ...Codec) (string, error) {
+	data, err := codecOf(codec).Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeArgs decode the job args to a T.
+func DecodeArgs[T any](args string, codec ...Codec) (T, error) {
+	var v T
+	err := codecOf(codec).Unmarshal([]byte(args), &v)
+	return v, err
+}
+
+// SubmitTyped encode args and submit the job, the other opts are the same as
+// Client.SubmitJob.
+func SubmitTyped[T any](c ClientI, funcName, name string, args T, opts map[string]interface{}, codec ...Codec) error {
+	encoded, err := EncodeArgs(args, codec...)
+	if err != nil {
+		return fmt.Errorf("Encode args error: %w", err)
+	}
+	submitOpts := make(map[string]interface{}, len(opts)+1)
+	for k, v := range opts {
+		submitOpts[k] = v
+	}
+	submitOpts["args"] = encoded
+	return c.SubmitJob(funcName, name, submitOpts)
+}
+
+// AddTypedFunc add a typed handler to the worker, see TypedFunc.
+func AddTypedFunc[T any](w WorkerI, funcName string, handler func(context.Context, TypedJob[T]) error, codec ...Codec) error {
+	return w.AddFunc(funcName, TypedFunc(handler, codec...))
+}
+
+// TypedFunc wrap a typed handler as a worker task. The job fail without
+// retry when the args can not be decoded. The handler result tell the
+// server the job state: nil is done, a SchedLater error sched it later and
+// any other error fail it by the retry policy.
+func TypedFunc[T any](handler func(context.Context, TypedJob[T]) error, codec ...Codec) func(Job) {
+	cd := codecOf(codec)
+	return func(job Job) {
+		args, err := DecodeArgs[T](job.Args, cd)
+		if err != nil {
+			job.Worker.logger.Warn("decode args failed", "func", job.FuncName, "job", job.Name, "error", err)
+			job.FailWith(Permanent(fmt.Errorf("decode args: %w", err)))
+			return
+		}
+		err = handler(job.Context(), TypedJob[T]{Job: job, Args: args})
+		var later *SchedLaterError
+		switch {
+		case err == nil:
+			job.Done()
+		case errors.As(err, &later):
+			job.SchedLater(later.Delay, later.Counter)
+		default:
+			job.Worker.logger.Warn("job failed", "func", job.FuncName, "job", job.Name, "error", err)
+			job.FailWith(err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package periodic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression defined the compression of the job args.
+type Compression string
+
+const (
+	// NoCompression keep the args as is.
+	NoCompression Compression = ""
+	// Gzip compress the args by gzip.
+	Gzip Compression = "gzip"
+	// Zstd compress the args by zstd.
+	Zstd Compression = "zstd"
+)
+
+const (
+	gzipMarker = "\x00GZP"
+	zstdMarker = "\x00ZST"
+)
+
+// CompressMinSize the args smaller than it are not compressed.
+var CompressMinSize = 1024
+
+// DecompressMaxSize the max size of the decompressed args, a larger job fail
+// without retry. Set it before the first job is received.
+var DecompressMaxSize = 64 << 20
+
+// ErrArgsTooLarge error on the decompressed args larger than
+// DecompressMaxSize.
+var ErrArgsTooLarge = errors.New("Decompressed args too large")
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(DecompressMaxSize)))
+	})
+	return zstdErr
+}
+
+// ParseCompression parse a compression name: none, gzip or zstd.
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return NoCompression, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	}
+	return NoCompression, fmt.Errorf("Unknow compression %s", name)
+}
+
+// CompressArgs compress the args with a marker, so the worker decompress it
+// automatically. The args smaller than CompressMinSize are kept as is.
+func CompressArgs(args []byte, compression Compression) (string, error) {
+	if compression == NoCompression || len(args) < CompressMinSize {
+		return string(args), nil
+	}
+	buf := bytes.NewBuffer(nil)
+	switch compression {
+	case Gzip:
+		buf.WriteString(gzipMarker)
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(args); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+	case Zstd:
+		if err := initZstd(); err != nil {
+			return "", err
+		}
+		buf.WriteString(zstdMarker)
+		buf.Write(zstdEncoder.EncodeAll(args, nil))
+	default:
+		return "", fmt.Errorf("Unknow compression %s", compression)
+	}
+	return buf.String(), nil
+}
+
+// DecompressArgs decompress the args compressed by CompressArgs, the other
+// args are returned as is. A permanent ErrArgsTooLarge when the decompressed
+// args are larger than DecompressMaxSize.
+func DecompressArgs(args string) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(args, gzipMarker):
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(strings.NewReader(args[len(gzipMarker):])); err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		data, err = io.ReadAll(io.LimitReader(r, int64(DecompressMaxSize)+1))
+	case strings.HasPrefix(args, zstdMarker):
+		if err = initZstd(); err != nil {
+			return nil, err
+		}
+		data, err = zstdDecoder.DecodeAll([]byte(args[len(zstdMarker):]), nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, Permanent(ErrArgsTooLarge)
+		}
+	default:
+		return []byte(args), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > DecompressMaxSize {
+		return nil, Permanent(ErrArgsTooLarge)
+	}
+	return data, nil
+}
+
+// argsOf return the args of the submit opts, a string or []byte,
+// compressed by the "compress" opt.
+func argsOf(opts map[string]interface{}) (string, error) {
+	var args []byte
+	switch v := opts["args"].(type) {
+	case string:
+		args = []byte(v)
+	case []byte:
+		args = v
+	}
+	var compression Compression
+	switch v := opts["compress"].(type) {
+	case Compression:
+		compression = v
+	case string:
+		var err error
+		if compression, err = ParseCompression(v); err != nil {
+			return "", err
+		}
+	}
+	return CompressArgs(args, compression)
+}
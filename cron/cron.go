@@ -0,0 +1,349 @@
+// Package cron schedule recurring periodic jobs by cron expressions.
+//
+// The expression has 5 fields, or 6 with the seconds first:
+//
+//	[second] minute hour day-of-month month day-of-week
+//
+// A field is a "*" (or "?" for the days), a value, a range "1-5", a step
+// "*/15" or "10-40/10", or a list of them "1,15,30". The months and the days
+// of week also accept the names JAN-DEC and SUN-SAT, sunday is 0 or 7.
+// When both days fields are restricted, a day matching either one fires.
+//
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight,
+// @hourly and "@every <duration>" are supported. The expression is in local
+// time unless prefixed by a timezone: "CRON_TZ=Asia/Shanghai 0 9 * * *".
+//
+// The schedule is carried by an envelope around the job args, the worker
+// middleware remove the envelope and sched the job to the next fire time
+// instead of finishing it.
+//
+//	cron.SubmitCron(client, "funcName", "name", "*/5 * * * *", opts)
+//
+//	worker.Use(cron.Middleware())
+package cron
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule defined when a recurring job fire.
+type Schedule interface {
+	// Next return the next fire time after t, zero if none.
+	Next(t time.Time) time.Time
+}
+
+// SpecSchedule a schedule of cron fields, each field is a bitset of the
+// values, starBit is set when the field is "*".
+type SpecSchedule struct {
+	Second, Minute, Hour, Dom, Month, Dow uint64
+	Location                              *time.Location
+}
+
+// EverySchedule a schedule fire at a constant interval.
+type EverySchedule struct {
+	Every time.Duration
+}
+
+const starBit = 1 << 63
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse a cron expression.
+func Parse(expr string) (Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	loc := time.Local
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("cron: missing fields in %q", expr)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("cron: invalid timezone %q: %w", name, err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("cron: invalid duration in %q: %w", expr, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("cron: duration in %q less than a second", expr)
+		}
+		return EverySchedule{Every: every}, nil
+	}
+	if strings.HasPrefix(spec, "@") {
+		var ok bool
+		if spec, ok = descriptors[spec]; !ok {
+			return nil, fmt.Errorf("cron: unknow descriptor %q", expr)
+		}
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron: expected 5 or 6 fields, got %d in %q", len(fields), expr)
+	}
+
+	s := &SpecSchedule{Location: loc}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+	}{
+		{&s.Second, seconds},
+		{&s.Minute, minutes},
+		{&s.Hour, hours},
+		{&s.Dom, dom},
+		{&s.Month, months},
+		{&s.Dow, dow},
+	} {
+		if *f.bits, err = parseField(fields[i], f.b); err != nil {
+			return nil, fmt.Errorf("cron: %w in %q", err, expr)
+		}
+	}
+	// sunday is 0 or 7
+	if s.Dow&(1<<7) > 0 {
+		s.Dow = s.Dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// MustParse parse a cron expression, panic on error.
+func MustParse(expr string) Schedule {
+	s, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		v, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= v
+	}
+	return bits, nil
+}
+
+// parseRange parse a "*", "?", "a", "a-b" with an optional "/step".
+func parseRange(expr string, b bounds) (uint64, error) {
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("invalid step %q", expr)
+	}
+	// the day of week 7 is only an alias of sunday
+	max := b.max
+	if b.max == dow.max {
+		max = 6
+	}
+	var start, end uint
+	var extra uint64
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid range %q", expr)
+		}
+		start, end = b.min, max
+		extra = starBit
+	} else {
+		var err error
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		switch len(lowAndHigh) {
+		case 1:
+			end = start
+		case 2:
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("invalid range %q", expr)
+		}
+	}
+
+	step := uint(1)
+	if len(rangeAndStep) == 2 {
+		v, err := strconv.ParseUint(rangeAndStep[1], 10, 8)
+		if err != nil || v == 0 {
+			return 0, fmt.Errorf("invalid step %q", expr)
+		}
+		step = uint(v)
+		extra = 0
+		// "a/step" means "a-max/step"
+		if len(lowAndHigh) == 1 && lowAndHigh[0] != "*" && lowAndHigh[0] != "?" {
+			end = max
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("invalid range %q, %d is after %d", expr, start, end)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseValue(expr string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(expr, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", expr)
+	}
+	if uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+// Next return the next fire time after t, zero if none in 5 years.
+func (s *SpecSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.Location)
+	// start at the next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.Month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.Location)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.Location)
+		}
+		t = t.AddDate(0, 0, 1)
+		// the midnight may not exist on daylight saving time changes
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.Hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.Location)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.Minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.Second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+// dayMatches return true when the day of month and the day of week match,
+// either one is enough when both are restricted.
+func (s *SpecSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.Dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.Dow > 0
+	if s.Dom&starBit > 0 || s.Dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next return the time after t by the interval, rounded to the second.
+func (s EverySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.Every - time.Duration(t.Nanosecond())*time.Nanosecond)
+}
+
+// Delay return the seconds from now to the next fire time, rounded up,
+// -1 if there is no next fire time.
+func Delay(s Schedule, now time.Time) int {
+	next := s.Next(now)
+	if next.IsZero() {
+		return -1
+	}
+	return int(math.Ceil(next.Sub(now).Seconds()))
+}
@@ -0,0 +1,120 @@
+package cron
+
+import (
+	"github.com/Lupino/go-periodic"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2024, 1, 31, 10, 20, 30, 500, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * * *", time.Date(2024, 1, 31, 10, 20, 45, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * sun", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * ?", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 1, 31, 10, 22, 0, 0, time.UTC)},
+		{"CRON_TZ=Asia/Shanghai 0 9 * * *", time.Date(2024, 2, 1, 9, 0, 0, 0, shanghai)},
+	} {
+		expr := tc.expr
+		if !strings.HasPrefix(expr, "CRON_TZ=") {
+			expr = "TZ=UTC " + expr
+		}
+		s, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.expr, err)
+		}
+		if next := s.Next(from); !next.Equal(tc.next) {
+			t.Fatalf("%s: except %s, got %s", tc.expr, tc.next, next)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * mon-",
+		"@weekday",
+		"@every 1ms",
+		"CRON_TZ=Nowhere/City * * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("%q: except error", expr)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	now := time.Date(2024, 1, 31, 10, 20, 30, 500, time.UTC)
+	if delay := Delay(MustParse("TZ=UTC 0 * * * *"), now); delay != 39*60+30 {
+		t.Fatalf("except %d, got %d", 39*60+30, delay)
+	}
+	if delay := Delay(MustParse("TZ=UTC 0 0 30 feb *"), now); delay != -1 {
+		t.Fatalf("except no next fire time, got %d", delay)
+	}
+}
+
+// fakeClient keep the submitted opts.
+type fakeClient struct {
+	periodic.ClientI
+	opts map[string]interface{}
+}
+
+func (c *fakeClient) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	c.opts = opts
+	return nil
+}
+
+func TestSubmitCron(t *testing.T) {
+	fake := new(fakeClient)
+	if err := SubmitCron(fake, "test", "job", "*/5 * * * *", map[string]interface{}{"args": "data"}); err != nil {
+		t.Fatal(err)
+	}
+	schedAt, _ := fake.opts["schedat"].(int64)
+	if delay := schedAt - time.Now().Unix(); delay < 0 || delay > 5*60 {
+		t.Fatalf("except first run in 5 minutes, got %d", delay)
+	}
+
+	var got periodic.Job
+	task := Middleware()(func(job periodic.Job) {
+		got = job
+	})
+	task(periodic.Job{FuncName: "test", Name: "job", Args: fake.opts["args"].(string)})
+	if got.Args != "data" || got.Raw.Args != "data" {
+		t.Fatalf("except the envelope removed, got %q", got.Args)
+	}
+
+	if err := SubmitCron(fake, "test", "job", "@daily", map[string]interface{}{"args": []byte("bytes")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, args, _ := Unwrap(fake.opts["args"].(string)); args != "bytes" {
+		t.Fatalf("except []byte args kept, got %q", args)
+	}
+	if err := SubmitCron(fake, "test", "job", "@daily", map[string]interface{}{"args": 1}); err == nil {
+		t.Fatal("except error on invalid args type")
+	}
+
+	if err := SubmitCron(fake, "test", "job", "0 0 30 feb *", nil); err != ErrNoNext {
+		t.Fatalf("except %v, got %v", ErrNoNext, err)
+	}
+}
@@ -0,0 +1,112 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"time"
+)
+
+// MagicEnvelope the prefix of the args carry a cron expression.
+var MagicEnvelope = []byte("\x00CRN")
+
+// ErrNoNext error on the schedule never fire again.
+var ErrNoNext = errors.New("cron: no next fire time")
+
+// Wrap the args with an envelope carry the cron expression.
+func Wrap(expr, args string) string {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(MagicEnvelope)
+	h16 := make([]byte, 2)
+	binary.BigEndian.PutUint16(h16, uint16(len(expr)))
+	buf.Write(h16)
+	buf.WriteString(expr)
+	buf.WriteString(args)
+	return buf.String()
+}
+
+// Unwrap the args envelope, return the cron expression and the original
+// args. ok is false when the args have no envelope.
+func Unwrap(args string) (expr, orig string, ok bool) {
+	payload := []byte(args)
+	if !bytes.HasPrefix(payload, MagicEnvelope) {
+		return "", args, false
+	}
+	payload = payload[len(MagicEnvelope):]
+	if len(payload) < 2 {
+		return "", args, false
+	}
+	length := int(binary.BigEndian.Uint16(payload[0:2]))
+	payload = payload[2:]
+	if len(payload) < length {
+		return "", args, false
+	}
+	return string(payload[0:length]), string(payload[length:]), true
+}
+
+// SubmitCron submit a recurring job fired at the cron expression, the first
+// run is the next fire time. The other opts are the same as
+// Client.SubmitJob, the args is a string or []byte.
+// The workers of the func must use the Middleware.
+func SubmitCron(c periodic.ClientI, funcName, name, expr string, opts map[string]interface{}) error {
+	s, err := Parse(expr)
+	if err != nil {
+		return err
+	}
+	if len(expr) > 0xFFFF {
+		return errors.New("cron: expression too long")
+	}
+	next := s.Next(time.Now())
+	if next.IsZero() {
+		return ErrNoNext
+	}
+	submitOpts := make(map[string]interface{}, len(opts)+2)
+	for k, v := range opts {
+		submitOpts[k] = v
+	}
+	var args string
+	switch v := opts["args"].(type) {
+	case nil:
+	case string:
+		args = v
+	case []byte:
+		args = string(v)
+	default:
+		return fmt.Errorf("cron: invalid args type %T", v)
+	}
+	submitOpts["args"] = Wrap(expr, args)
+	submitOpts["schedat"] = next.Unix()
+	return c.SubmitJob(funcName, name, submitOpts)
+}
+
+// Middleware return a worker middleware remove the cron envelope, and sched
+// the job to the next fire time when the handler call Done. The jobs without
+// envelope are handled as usual.
+func Middleware() periodic.Middleware {
+	return func(task func(periodic.Job)) func(periodic.Job) {
+		return func(job periodic.Job) {
+			expr, args, ok := Unwrap(job.Args)
+			if !ok {
+				task(job)
+				return
+			}
+			s, err := Parse(expr)
+			if err != nil {
+				job.Worker.Logger().Error("invalid cron expression", "func", job.FuncName, "job", job.Name, "error", err)
+				job.Fail()
+				return
+			}
+			job.Args = args
+			job.Raw.Args = args
+			task(job.WithDone(func(job periodic.Job, data ...[]byte) error {
+				delay := Delay(s, time.Now())
+				if delay < 0 {
+					return job.Done(data...)
+				}
+				return job.SchedLater(delay)
+			}))
+		}
+	}
+}
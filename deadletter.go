@@ -0,0 +1,83 @@
+package periodic
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const deadLetterSuffix = ".dead"
+
+// DeadLetterPolicy move the failed jobs to the dead-letter func without retry.
+var DeadLetterPolicy = RetryPolicy{MaxAttempts: 1, Final: FinalDeadLetter}
+
+// DeadLetter defined a job moved to a dead-letter func, it is the json args
+// of the dead-letter job.
+type DeadLetter struct {
+	Func     string `json:"func"`
+	Name     string `json:"name"`
+	Args     []byte `json:"args"`
+	Counter  int32  `json:"counter"`
+	Reason   string `json:"reason"`
+	FailedAt int64  `json:"failed_at"`
+}
+
+// DeadLetterFunc return the default dead-letter func of a func.
+func DeadLetterFunc(funcName string) string {
+	return funcName + deadLetterSuffix
+}
+
+// IsDeadLetterFunc return true when the func is a default dead-letter func.
+func IsDeadLetterFunc(funcName string) bool {
+	return strings.HasSuffix(funcName, deadLetterSuffix)
+}
+
+// ParseDeadLetter decode the args of a dead-letter job.
+func ParseDeadLetter(args string) (d DeadLetter, err error) {
+	err = json.Unmarshal([]byte(args), &d)
+	return
+}
+
+// Requeue submit the dead job to its original func with the counter reset.
+func (d DeadLetter) Requeue(c ClientI) error {
+	return c.SubmitJob(d.Func, d.Name, map[string]interface{}{
+		"args": d.Args,
+	})
+}
+
+// deadLetter submit the job to the dead-letter func and done it, the
+// middlewares can not change the done, eg. to sched it later.
+// The job stay on the server when the submit fail.
+func (j Job) deadLetter(deadFunc string, err error) error {
+	reason := "job failed"
+	if err != nil {
+		reason = err.Error()
+	}
+	// the raw args keep the envelopes of the middlewares, decompress them
+	// unless it is the failure
+	rawArgs, decompressErr := DecompressArgs(j.Raw.Args)
+	if decompressErr != nil {
+		rawArgs = []byte(j.Raw.Args)
+	}
+	args, _ := json.Marshal(DeadLetter{
+		Func:     j.FuncName,
+		Name:     j.Name,
+		Args:     rawArgs,
+		Counter:  j.Raw.Counter,
+		Reason:   reason,
+		FailedAt: time.Now().Unix(),
+	})
+	if err := j.Worker.SubmitJob(deadFunc, j.Name, map[string]interface{}{
+		"args": args,
+	}); err != nil {
+		j.Worker.logger.Error("dead letter failed", "func", j.FuncName, "job", j.Name, "error", err)
+		return j.FailWith(err)
+	}
+	j.Worker.logger.Warn("job moved to dead letter", "func", j.FuncName, "job", j.Name, "dead_func", deadFunc, "reason", reason)
+	if err := j.workDone(nil); err != nil {
+		return err
+	}
+	j.finish(ResultDead, nil, errors.New(reason))
+	return nil
+}
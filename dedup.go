@@ -0,0 +1,54 @@
+package periodic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrJobExists error on submit a job with SubmitIfAbsent and the job exists.
+var ErrJobExists = errors.New("Job exists")
+
+// SubmitMode defined how a job is submitted when a job of the same name
+// exists.
+type SubmitMode string
+
+const (
+	// SubmitDefault let the server update the existing job.
+	SubmitDefault SubmitMode = ""
+	// SubmitIfAbsent fail with ErrJobExists when the job exists, it need
+	// the Go server.
+	SubmitIfAbsent SubmitMode = "if-absent"
+	// SubmitReplace remove the existing job first, so its counter and
+	// state are reset. It is not atomic, the job may run between.
+	SubmitReplace SubmitMode = "replace"
+)
+
+// ParseSubmitMode parse a submit mode name, empty is SubmitDefault.
+func ParseSubmitMode(name string) (SubmitMode, error) {
+	switch mode := SubmitMode(name); mode {
+	case SubmitDefault, SubmitIfAbsent, SubmitReplace:
+		return mode, nil
+	}
+	return SubmitDefault, fmt.Errorf("Invalid submit mode: %s", name)
+}
+
+// submitModeOf return the submit mode of the submit opts.
+func submitModeOf(opts map[string]interface{}) (SubmitMode, error) {
+	switch v := opts["mode"].(type) {
+	case SubmitMode:
+		return v, nil
+	case string:
+		return ParseSubmitMode(v)
+	}
+	return SubmitDefault, nil
+}
+
+// HashName return a deterministic job name from the args, the same args
+// always have the same name, so submit them twice is idempotent.
+// The name is prefix with 32 hex chars of the sha256 of args.
+func HashName(prefix string, args []byte) string {
+	sum := sha256.Sum256(args)
+	return prefix + hex.EncodeToString(sum[:16])
+}
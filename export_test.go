@@ -0,0 +1,35 @@
+package periodic
+
+import (
+	"github.com/Lupino/go-periodic/types"
+	"testing"
+)
+
+// FakeServer export the fake server to the external tests.
+type FakeServer struct {
+	s *fakeServer
+}
+
+// NewFakeServer start a fake server closed by the test cleanup.
+func NewFakeServer(t *testing.T) FakeServer {
+	return FakeServer{newFakeServer(t)}
+}
+
+// Addr return the server address.
+func (fs FakeServer) Addr() string {
+	return fs.s.addr
+}
+
+// Assign the jobs to the workers, one job per grab.
+func (fs FakeServer) Assign(jobs ...types.Job) {
+	fs.s.locker.Lock()
+	defer fs.s.locker.Unlock()
+	fs.s.grab = func(msgID []byte) {
+		fs.s.locker.Lock()
+		defer fs.s.locker.Unlock()
+		if len(jobs) > 0 {
+			go jobAssign(fs.s, msgID, jobs[0])
+			jobs = jobs[1:]
+		}
+	}
+}
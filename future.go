@@ -0,0 +1,118 @@
+package periodic
+
+import (
+	"context"
+	"fmt"
+	"github.com/Lupino/go-periodic/protocol"
+	"sync"
+	"time"
+)
+
+// Future defined the pending result of an asynchronous RunJob.
+type Future struct {
+	done chan struct{}
+	once *sync.Once
+	data []byte
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{}), once: new(sync.Once)}
+}
+
+// resolve the future, return false when it is already resolved.
+func (f *Future) resolve(data []byte, err error) bool {
+	resolved := false
+	f.once.Do(func() {
+		f.data = data
+		f.err = err
+		resolved = true
+		close(f.done)
+	})
+	return resolved
+}
+
+// Done return a channel closed when the result is ready.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result wait and return the job result.
+func (f *Future) Result() ([]byte, error) {
+	<-f.done
+	return f.data, f.err
+}
+
+// Wait the job result until the context done. The job is not canceled
+// when the context of Wait is done, only the context of RunJobAsync does.
+func (f *Future) Wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-f.done:
+		return f.data, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RunJobAsync run job on periodic server and return a future of the result
+// without blocking. The request is abandoned when the context is canceled or
+// its deadline exceeded, the future then resolve with the context error.
+// Many requests can be in flight over the connection.
+//
+//	opts = map[string]interface{}{
+//	  "args": args,
+//	  "timeout": timeout,
+//	}
+func (c *Client) RunJobAsync(ctx context.Context, funcName, name string, opts map[string]interface{}) *Future {
+	future := newFuture()
+	if err := ctx.Err(); err != nil {
+		future.resolve(nil, err)
+		return future
+	}
+	if !c.isConnected() {
+		future.resolve(nil, ErrNotConnected)
+		return future
+	}
+
+	payload, err := runJobPayload(funcName, name, opts)
+	if err != nil {
+		future.resolve(nil, err)
+		return future
+	}
+
+	start := time.Now()
+	agent := c.newAgentWithCallback(func(cmd protocol.Command, data []byte, err error) {
+		if c.observer != nil {
+			c.observer.ObserveCommand(protocol.RUNJOB, cmd, time.Since(start), err)
+		}
+		if err == nil && cmd == protocol.NO_WORKER {
+			err = fmt.Errorf("%w %s", ErrNoWorker, funcName)
+		}
+		future.resolve(data, err)
+	})
+
+	if err := agent.Send(protocol.RUNJOB, payload); err != nil {
+		c.removeAgent(agent.ID)
+		future.resolve(nil, err)
+		return future
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-future.done:
+			case <-ctx.Done():
+				if future.resolve(nil, ctx.Err()) {
+					c.removeAgent(agent.ID)
+				}
+			}
+		}()
+	}
+	return future
+}
+
+// RunJobContext run job on periodic server and get an result, it return
+// when the context is done.
+func (c *Client) RunJobContext(ctx context.Context, funcName, name string, opts map[string]interface{}) ([]byte, error) {
+	return c.RunJobAsync(ctx, funcName, name, opts).Result()
+}
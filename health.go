@@ -0,0 +1,223 @@
+package periodic
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPingTimeout error on ping not answered in time
+	ErrPingTimeout = errors.New("Ping timeout")
+	// ErrPingFailed error on server not answer PONG
+	ErrPingFailed = errors.New("Ping failed")
+	// ErrNotConnected error on send command while the connection is lost
+	ErrNotConnected = errors.New("Not connected")
+)
+
+// HealthStats defined the connection health of a client.
+type HealthStats struct {
+	Connected bool          // The connection is alive.
+	Healthy   bool          // Failures is under the failure threshold.
+	Latency   time.Duration // The last measured ping round-trip latency.
+	Failures  int           // The count of consecutive ping failures.
+	LastPing  time.Time     // When the last ping finished.
+}
+
+// health keep the keepalive config, stats and callbacks of a client.
+type health struct {
+	locker       *sync.RWMutex
+	interval     time.Duration
+	threshold    int
+	stats        HealthStats
+	onDisconnect func(error)
+	onReconnect  func()
+	onUnhealthy  func(error)
+}
+
+func newHealth() *health {
+	return &health{
+		locker:    new(sync.RWMutex),
+		interval:  time.Second,
+		threshold: 3,
+	}
+}
+
+func (h *health) getInterval() time.Duration {
+	h.locker.RLock()
+	defer h.locker.RUnlock()
+	return h.interval
+}
+
+// record a ping result, return true when the connection just turn unhealthy.
+func (h *health) record(latency time.Duration, err error) bool {
+	h.locker.Lock()
+	defer h.locker.Unlock()
+	h.stats.LastPing = time.Now()
+	if err == nil {
+		h.stats.Latency = latency
+		h.stats.Failures = 0
+		h.stats.Healthy = true
+		return false
+	}
+	h.stats.Failures++
+	if h.stats.Healthy && h.stats.Failures >= h.threshold {
+		h.stats.Healthy = false
+		return true
+	}
+	return false
+}
+
+func (h *health) connected() {
+	h.locker.Lock()
+	defer h.locker.Unlock()
+	h.stats.Connected = true
+	h.stats.Healthy = true
+	h.stats.Failures = 0
+}
+
+func (h *health) disconnected() {
+	h.locker.Lock()
+	defer h.locker.Unlock()
+	h.stats.Connected = false
+	h.stats.Healthy = false
+}
+
+// SetKeepAlive set the ping interval and the count of consecutive ping
+// failures before the connection is considered unhealthy.
+// The default is ping every second and 3 failures.
+func (c *Client) SetKeepAlive(interval time.Duration, threshold int) {
+	c.health.locker.Lock()
+	defer c.health.locker.Unlock()
+	if interval > 0 {
+		c.health.interval = interval
+	}
+	if threshold > 0 {
+		c.health.threshold = threshold
+	}
+}
+
+// OnDisconnect set a callback called when the connection is lost.
+func (c *Client) OnDisconnect(fn func(error)) {
+	c.health.locker.Lock()
+	defer c.health.locker.Unlock()
+	c.health.onDisconnect = fn
+}
+
+// OnReconnect set a callback called when the connection is reestablished.
+func (c *Client) OnReconnect(fn func()) {
+	c.health.locker.Lock()
+	defer c.health.locker.Unlock()
+	c.health.onReconnect = fn
+}
+
+// OnUnhealthy set a callback called when the failure threshold is reached,
+// the connection is then closed and reconnected.
+func (c *Client) OnUnhealthy(fn func(error)) {
+	c.health.locker.Lock()
+	defer c.health.locker.Unlock()
+	c.health.onUnhealthy = fn
+}
+
+// Health return the connection health stats.
+func (c *Client) Health() HealthStats {
+	c.health.locker.RLock()
+	defer c.health.locker.RUnlock()
+	return c.health.stats
+}
+
+// Latency return the last measured ping round-trip latency.
+func (c *Client) Latency() time.Duration {
+	return c.Health().Latency
+}
+
+// Healthy return true when the server is reachable.
+func (c *Client) Healthy() bool {
+	return c.Health().Healthy
+}
+
+// checkHealth check connection health.
+func (c *Client) checkHealth() {
+	for c.isAlive() {
+		interval := c.health.getInterval()
+		time.Sleep(interval)
+		if !c.isAlive() || !c.isConnected() {
+			continue
+		}
+		latency, err := c.ping(interval)
+		if !c.health.record(latency, err) {
+			continue
+		}
+		c.logger.Warn("connection unhealthy", "addr", c.addr, "error", err)
+		c.health.locker.RLock()
+		fn := c.health.onUnhealthy
+		c.health.locker.RUnlock()
+		if fn != nil {
+			fn(err)
+		}
+		// force the receive loop to fail and reconnect.
+		c.getConn().Close()
+	}
+}
+
+// reconnect dial the server until success or the client closed.
+func (c *Client) reconnect() {
+	delay := c.health.getInterval()
+	for c.isAlive() {
+		conn, err := c.dial()
+		if err != nil {
+			c.logger.Debug("reconnect failed", "addr", c.addr, "error", err, "retry", delay)
+			time.Sleep(delay)
+			if delay < 30*time.Second {
+				delay = delay * 2
+			}
+			continue
+		}
+		c.locker.Lock()
+		if !c.alive {
+			c.locker.Unlock()
+			conn.Close()
+			return
+		}
+		c.conn = conn
+		c.connected = true
+		c.locker.Unlock()
+		c.health.connected()
+		c.logger.Info("reconnected", "addr", c.addr)
+
+		go c.receiveLoop(conn)
+
+		if c.reconnected != nil {
+			c.reconnected()
+		}
+
+		c.health.locker.RLock()
+		fn := c.health.onReconnect
+		c.health.locker.RUnlock()
+		if fn != nil {
+			fn()
+		}
+		return
+	}
+}
+
+// disconnect fail all the waiting agents and start reconnect.
+func (c *Client) disconnect(err error) {
+	c.locker.Lock()
+	c.connected = false
+	for agentID, agent := range c.agents {
+		agent.FeedError(err)
+		delete(c.agents, agentID)
+	}
+	c.locker.Unlock()
+	c.health.disconnected()
+	c.logger.Warn("connection lost", "addr", c.addr, "error", err)
+
+	c.health.locker.RLock()
+	fn := c.health.onDisconnect
+	c.health.locker.RUnlock()
+	if fn != nil {
+		fn(err)
+	}
+	go c.reconnect()
+}
@@ -0,0 +1,94 @@
+package periodic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Lupino/go-periodic/protocol"
+	"math"
+	"time"
+)
+
+// Heartbeat tell periodic server the job is still running, its timeout
+// restart from now. ErrNotSupported if the server do not support it.
+func (j *Job) Heartbeat() error {
+	return j.heartbeat(0)
+}
+
+// ExtendTimeout tell periodic server the job need d more to finish, the
+// timeout restart from now with d. ErrNotSupported if the server do not
+// support it.
+func (j *Job) ExtendTimeout(d time.Duration) error {
+	timeout := int64(math.Ceil(d.Seconds()))
+	if timeout < 1 {
+		timeout = 1
+	}
+	return j.heartbeat(timeout)
+}
+
+// heartbeat send the HEARTBEAT with timeout in seconds, 0 is the job
+// timeout.
+func (j *Job) heartbeat(timeout int64) error {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(j.Handle)
+	h64 := make([]byte, 8)
+	binary.BigEndian.PutUint64(h64, uint64(timeout))
+	buf.Write(h64)
+	ret, data, err := j.Worker.sendCommandAndReceive(protocol.HEARTBEAT, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	switch ret {
+	case protocol.SUCCESS:
+		return nil
+	case protocol.UNKNOWN:
+		return ErrNotSupported
+	}
+	return fmt.Errorf("Heartbeat error: %s", data)
+}
+
+// heartbeatMaxInterval cap the heartbeat interval of the jobs without
+// timeout, they use the server default timeout, which the worker not know.
+const heartbeatMaxInterval = 10 * time.Second
+
+// SetHeartbeat send a heartbeat on interval while the job handler is
+// running, so a slow job is not reverted to another worker. The interval is
+// capped to half of the job timeout, or 10s for a job without timeout,
+// 0 disable it.
+func (w *Worker) SetHeartbeat(interval time.Duration) {
+	w.heartbeat = interval
+}
+
+// keepAlive start the heartbeat of a job, stop it when the handler return.
+func (w *Worker) keepAlive(job Job) (stop func()) {
+	interval := w.heartbeat
+	if interval <= 0 {
+		return func() {}
+	}
+	max := heartbeatMaxInterval
+	if job.Raw.Timeout > 0 {
+		max = time.Duration(job.Raw.Timeout) * time.Second / 2
+	}
+	if interval > max {
+		interval = max
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if err := job.Heartbeat(); err != nil {
+				w.logger.Warn("heartbeat failed", "func", job.FuncName, "job", job.Name, "error", err)
+				if err == ErrNotSupported {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
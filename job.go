@@ -2,10 +2,12 @@ package periodic
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/Lupino/go-periodic/protocol"
 	"github.com/Lupino/go-periodic/types"
+	"time"
 )
 
 // Job defined a job type.
@@ -16,6 +18,10 @@ type Job struct {
 	Name     string
 	Args     string
 	Handle   []byte
+	ctx      context.Context
+	done     func(Job, ...[]byte) error
+	fail     func(Job, error) error
+	received time.Time
 }
 
 // NewJob create a job
@@ -43,24 +49,113 @@ func NewJob(bc *Worker, data []byte) (job Job, err error) {
 	return
 }
 
+func (j *Job) observeFinished(status protocol.Command) {
+	if j.Worker.observer != nil {
+		j.Worker.observer.ObserveJobFinished(j.FuncName, status)
+	}
+}
+
+// decompress the args compressed by the client.
+func (j *Job) decompress() error {
+	args, err := DecompressArgs(j.Args)
+	if err != nil {
+		return err
+	}
+	j.Args = string(args)
+	return nil
+}
+
+// ArgsBytes return the job args as bytes, the args are binary safe.
+func (j Job) ArgsBytes() []byte {
+	return []byte(j.Args)
+}
+
+// Context return the job context, the default is context.Background().
+func (j Job) Context() context.Context {
+	if j.ctx != nil {
+		return j.ctx
+	}
+	return context.Background()
+}
+
+// WithContext return a copy of the job with the context changed.
+func (j Job) WithContext(ctx context.Context) Job {
+	j.ctx = ctx
+	return j
+}
+
+// WithDone return a copy of the job with Done replaced by fn, eg. for a
+// middleware to sched a recurring job later instead of finish it.
+// The job passed to fn has the previous Done.
+func (j Job) WithDone(fn func(job Job, data ...[]byte) error) Job {
+	prev := j.done
+	j.done = func(job Job, data ...[]byte) error {
+		job.done = prev
+		return fn(job, data...)
+	}
+	return j
+}
+
 // Done tell periodic server the job done.
 func (j *Job) Done(data ...[]byte) error {
-	buf := bytes.NewBuffer(nil)
-	buf.Write(j.Handle)
+	if j.done != nil {
+		job := *j
+		job.done = nil
+		return j.done(job, data...)
+	}
+	var output []byte
 	if len(data) == 1 {
-		buf.Write(data[0])
+		output = data[0]
+	}
+	if err := j.workDone(output); err != nil {
+		return err
 	}
+	j.finish(ResultDone, output, nil)
+	return nil
+}
+
+// workDone send the WORKDONE with the output.
+func (j *Job) workDone(output []byte) error {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(j.Handle)
+	buf.Write(output)
 	ret, vv, _ := j.Worker.sendCommandAndReceive(protocol.WORKDONE, buf.Bytes())
 	if ret == protocol.SUCCESS {
+		j.observeFinished(protocol.WORKDONE)
 		return nil
 	}
 	return fmt.Errorf("Done error: %s", vv)
 }
 
+// WithFail return a copy of the job with Fail and FailWith replaced by fn,
+// eg. for a middleware to retry the job. The job passed to fn has the
+// previous FailWith.
+func (j Job) WithFail(fn func(job Job, err error) error) Job {
+	prev := j.fail
+	j.fail = func(job Job, err error) error {
+		job.fail = prev
+		return fn(job, err)
+	}
+	return j
+}
+
 // Fail tell periodic server the job fail.
 func (j *Job) Fail() error {
+	return j.FailWith(nil)
+}
+
+// FailWith tell periodic server the job fail by err, the retry policy of
+// the func decide to retry it or not.
+func (j *Job) FailWith(err error) error {
+	if j.fail != nil {
+		job := *j
+		job.fail = nil
+		return j.fail(job, err)
+	}
 	ret, data, _ := j.Worker.sendCommandAndReceive(protocol.WORKFAIL, j.Handle)
 	if ret == protocol.SUCCESS {
+		j.observeFinished(protocol.WORKFAIL)
+		j.finish(ResultFail, nil, err)
 		return nil
 	}
 	return fmt.Errorf("Fail error: %s", data)
@@ -86,49 +181,34 @@ func (j *Job) SchedLater(opts ...int) error {
 	buf.Write(h16)
 	ret, data, _ := j.Worker.sendCommandAndReceive(protocol.SCHEDLATER, buf.Bytes())
 	if ret == protocol.SUCCESS {
+		j.observeFinished(protocol.SCHEDLATER)
 		return nil
 	}
 	return fmt.Errorf("SchedLater error: %s", data)
 }
 
-// Acquire acquire the lock from periodic server
+// Acquire acquire the lock from periodic server, the job run again once the
+// lock is released when it is not acquired.
 func (j *Job) Acquire(name string, count int) (error, bool) {
-	buf := bytes.NewBuffer(nil)
-	buf.WriteByte(byte(len(name)))
-	buf.WriteString(name)
-
-	h16 := make([]byte, 2)
-	binary.BigEndian.PutUint16(h16, uint16(count))
-	buf.Write(h16)
-	buf.Write(j.Handle)
-
-	ret, data, _ := j.Worker.sendCommandAndReceive(protocol.ACQUIRE, buf.Bytes())
-
-	if ret == protocol.ACQUIRED && data[0] == 1 {
-		return nil, true
-	}
-	return nil, false
+	acquired, err := j.Worker.acquire(name, count, j.Handle)
+	return err, acquired
 }
 
 // Release release lock
 func (j *Job) Release(name string) error {
-	buf := bytes.NewBuffer(nil)
-	buf.WriteByte(byte(len(name)))
-	buf.WriteString(name)
-	buf.Write(j.Handle)
-
-	ret, data, _ := j.Worker.sendCommandAndReceive(protocol.RELEASE, buf.Bytes())
-	if ret == protocol.SUCCESS {
-		return nil
-	}
-	return fmt.Errorf("Release error: %s", data)
+	return j.Worker.release(name, j.Handle)
 }
 
-// WithLock with lock
+// WithLock run task with the lock, it is released when task return or
+// panic.
 func (j *Job) WithLock(name string, count int, task func()) {
-	_, acquired := j.Acquire(name, count)
+	err, acquired := j.Acquire(name, count)
+	if err != nil {
+		j.Worker.logger.Error("acquire lock failed", "func", j.FuncName, "job", j.Name, "lock", name, "error", err)
+		return
+	}
 	if acquired {
+		defer j.Release(name)
 		task()
-		j.Release(name)
 	}
 }
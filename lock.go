@@ -0,0 +1,161 @@
+package periodic
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/Lupino/go-periodic/protocol"
+	"sync"
+	"time"
+)
+
+// acquire send the ACQUIRE of the lock for the handle, acquired is false when
+// the lock is full.
+func (c *Client) acquire(name string, count int, handle []byte) (acquired bool, err error) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+
+	h16 := make([]byte, 2)
+	binary.BigEndian.PutUint16(h16, uint16(count))
+	buf.Write(h16)
+	buf.Write(handle)
+
+	ret, data, err := c.sendCommandAndReceive(protocol.ACQUIRE, buf.Bytes())
+	if err != nil {
+		return false, err
+	}
+	switch ret {
+	case protocol.ACQUIRED:
+		if len(data) < 1 {
+			return false, fmt.Errorf("Acquire error: invalid reply")
+		}
+		return data[0] == 1, nil
+	case protocol.UNKNOWN:
+		return false, ErrNotSupported
+	}
+	return false, fmt.Errorf("Acquire error: %s", data)
+}
+
+// release send the RELEASE of the lock for the handle.
+func (c *Client) release(name string, handle []byte) error {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	buf.Write(handle)
+
+	ret, data, err := c.sendCommandAndReceive(protocol.RELEASE, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if ret == protocol.SUCCESS {
+		return nil
+	}
+	return fmt.Errorf("Release error: %s", data)
+}
+
+// lockerFunc the func of the Locker holder jobs, no worker do it.
+const lockerFunc = "periodic.locker"
+
+// Locker defined a holder of the periodic server locks, for the critical
+// sections out of the job handlers. The locks are shared with Job.Acquire,
+// a lock of count allow count holders at the same time.
+//
+// The server keep the waiting holders of a lock by job handle, so a Locker
+// submit a holder job of the func periodic.locker on the first acquire, it
+// is never run, Close remove it.
+//
+// The periodic server accept the locks on the worker connections, use the
+// Locker of a Worker, the Locker of a Client need the Go server.
+type Locker struct {
+	c         *Client
+	name      string
+	locker    sync.Mutex
+	submitted bool
+}
+
+// Locker create a lock holder, each Locker is a different holder.
+func (c *Client) Locker() *Locker {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Locker{c: c, name: hex.EncodeToString(id)}
+}
+
+// handle return the handle of the holder job, submit it first.
+func (l *Locker) handle() ([]byte, error) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	if !l.submitted {
+		if err := l.c.SubmitJob(lockerFunc, l.name, map[string]interface{}{}); err != nil {
+			return nil, err
+		}
+		l.submitted = true
+	}
+	return encodeHandle(lockerFunc, l.name), nil
+}
+
+// TryLock acquire the lock without waiting, return false when it is full.
+func (l *Locker) TryLock(name string, count int) (bool, error) {
+	handle, err := l.handle()
+	if err != nil {
+		return false, err
+	}
+	return l.c.acquire(name, count, handle)
+}
+
+// Lock acquire the lock, wait until it is acquired or ctx is done.
+func (l *Locker) Lock(ctx context.Context, name string, count int) error {
+	delay := 10 * time.Millisecond
+	for {
+		acquired, err := l.TryLock(name, count)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+	}
+}
+
+// Unlock release the lock.
+func (l *Locker) Unlock(name string) error {
+	return l.c.release(name, encodeHandle(lockerFunc, l.name))
+}
+
+// Close remove the holder job, unlock the locks first.
+func (l *Locker) Close() error {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	if !l.submitted {
+		return nil
+	}
+	if err := l.c.RemoveJob(lockerFunc, l.name); err != nil {
+		return err
+	}
+	l.submitted = false
+	return nil
+}
+
+// WithLock run fn with the lock, it is released when fn return or panic.
+func (l *Locker) WithLock(ctx context.Context, name string, count int, fn func() error) (err error) {
+	if err = l.Lock(ctx, name, count); err != nil {
+		return
+	}
+	defer func() {
+		if unlockErr := l.Unlock(name); err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,157 @@
+package periodic
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Level defined the log level.
+type Level int
+
+const (
+	// LevelDebug log everything
+	LevelDebug Level = iota
+	// LevelInfo log info, warn and error
+	LevelInfo
+	// LevelWarn log warn and error
+	LevelWarn
+	// LevelError log error only
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel parse a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("Unknow level %s", name)
+}
+
+// Logger defined a leveled structured logger, keyvals are alternating keys
+// and values. A *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// StdLogger a Logger write logfmt lines to a standard logger.
+type StdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// NewStdLogger create a StdLogger, skip the messages under the level.
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	return &StdLogger{logger: logger, level: level}
+}
+
+func (l *StdLogger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("level=")
+	buf.WriteString(level.String())
+	buf.WriteString(" msg=")
+	buf.WriteString(quote(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(fmt.Sprint(keyvals[i]))
+		buf.WriteByte('=')
+		if i+1 < len(keyvals) {
+			buf.WriteString(quote(fmt.Sprint(keyvals[i+1])))
+		} else {
+			buf.WriteString("MISSING")
+		}
+	}
+	l.logger.Print(buf.String())
+}
+
+// quote the value when it contains space, quote or non printable chars.
+func quote(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || !strconv.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Debug log a debug message.
+func (l *StdLogger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info log an info message.
+func (l *StdLogger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn log a warn message.
+func (l *StdLogger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error log an error message.
+func (l *StdLogger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// NopLogger a Logger discard all the messages.
+type NopLogger struct{}
+
+// Debug discard the message.
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+// Info discard the message.
+func (NopLogger) Info(msg string, keyvals ...interface{}) {}
+
+// Warn discard the message.
+func (NopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+// Error discard the message.
+func (NopLogger) Error(msg string, keyvals ...interface{}) {}
+
+// DefaultLogger the logger of the new clients and workers,
+// write info and above to stderr.
+var DefaultLogger Logger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LevelInfo)
+
+// SetLogger set the client logger.
+func (c *Client) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NopLogger{}
+	}
+	c.logger = logger
+}
+
+// Logger return the client logger.
+func (c *Client) Logger() Logger {
+	return c.logger
+}
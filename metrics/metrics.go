@@ -0,0 +1,212 @@
+/*
+Package metrics export periodic client and worker metrics for prometheus.
+
+	m := metrics.New()
+	w := periodic.NewWorker(10)
+	m.InstrumentWorker(w)
+	w.Connect(periodicServer)
+
+	http.Handle("/metrics", m.Handler())
+*/
+package metrics
+
+import (
+	"github.com/Lupino/go-periodic"
+	"github.com/Lupino/go-periodic/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const namespace = "periodic"
+
+// Metrics collect periodic metrics, it implements periodic.Observer and
+// protocol.Observer.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	jobs            *prometheus.CounterVec
+	jobsInflight    *prometheus.GaugeVec
+	handlerDuration *prometheus.HistogramVec
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	bytes           *prometheus.CounterVec
+	frames          *prometheus.CounterVec
+
+	poolSize    *prometheus.Desc
+	poolWaiting *prometheus.Desc
+	locker      *sync.RWMutex
+	workers     []*periodic.Worker
+}
+
+// New create a metrics with its own registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "worker",
+			Name:      "jobs_total",
+			Help:      "Jobs by function and status: received, done, failed or rescheduled.",
+		}, []string{"func", "status"}),
+		jobsInflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "worker",
+			Name:      "jobs_inflight",
+			Help:      "Jobs being handled by function.",
+		}, []string{"func"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "worker",
+			Name:      "handler_duration_seconds",
+			Help:      "Job handler duration by function.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 16),
+		}, []string{"func"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "request_duration_seconds",
+			Help:      "Request round-trip latency by command.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "request_errors_total",
+			Help:      "Requests failed by command and reason.",
+		}, []string{"command", "reason"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "conn",
+			Name:      "bytes_total",
+			Help:      "Payload bytes by direction: in or out.",
+		}, []string{"direction"}),
+		frames: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "conn",
+			Name:      "frames_total",
+			Help:      "Frames by direction: in or out.",
+		}, []string{"direction"}),
+		poolSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "worker", "pool_size"),
+			"Handler pool size of a worker.",
+			[]string{"worker"}, nil,
+		),
+		poolWaiting: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "worker", "pool_waiting"),
+			"Jobs waiting for a free handler of a worker.",
+			[]string{"worker"}, nil,
+		),
+		locker: new(sync.RWMutex),
+	}
+	m.registry.MustRegister(
+		m.jobs,
+		m.jobsInflight,
+		m.handlerDuration,
+		m.requestDuration,
+		m.requestErrors,
+		m.bytes,
+		m.frames,
+		poolCollector{m},
+	)
+	return m
+}
+
+// Registry return the prometheus registry of the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler return the prometheus /metrics http handler.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentClient set the metrics as the client observer,
+// must be called before Connect.
+func (m *Metrics) InstrumentClient(c *periodic.Client) {
+	c.SetObserver(m)
+}
+
+// InstrumentWorker set the metrics as the worker observer and export the
+// handler pool utilization, must be called before Connect.
+func (m *Metrics) InstrumentWorker(w *periodic.Worker) {
+	w.SetObserver(m)
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	m.workers = append(m.workers, w)
+}
+
+// ObserveCommand implements periodic.Observer.
+func (m *Metrics) ObserveCommand(cmd, ret protocol.Command, duration time.Duration, err error) {
+	command := cmd.Name()
+	m.requestDuration.WithLabelValues(command).Observe(duration.Seconds())
+	if err != nil {
+		m.requestErrors.WithLabelValues(command, "transport").Inc()
+		return
+	}
+	switch ret {
+	case protocol.SUCCESS, protocol.PONG, protocol.ACQUIRED, protocol.DATA, protocol.CONFIG:
+	default:
+		m.requestErrors.WithLabelValues(command, ret.Name()).Inc()
+	}
+}
+
+// ObserveJobReceived implements periodic.Observer.
+func (m *Metrics) ObserveJobReceived(funcName string) {
+	m.jobs.WithLabelValues(funcName, "received").Inc()
+	m.jobsInflight.WithLabelValues(funcName).Inc()
+}
+
+// ObserveJobHandled implements periodic.Observer.
+func (m *Metrics) ObserveJobHandled(funcName string, duration time.Duration) {
+	m.jobsInflight.WithLabelValues(funcName).Dec()
+	m.handlerDuration.WithLabelValues(funcName).Observe(duration.Seconds())
+}
+
+// ObserveJobFinished implements periodic.Observer.
+func (m *Metrics) ObserveJobFinished(funcName string, status protocol.Command) {
+	switch status {
+	case protocol.WORKDONE:
+		m.jobs.WithLabelValues(funcName, "done").Inc()
+	case protocol.WORKFAIL:
+		m.jobs.WithLabelValues(funcName, "failed").Inc()
+	case protocol.SCHEDLATER:
+		m.jobs.WithLabelValues(funcName, "rescheduled").Inc()
+	}
+}
+
+// FrameSent implements protocol.Observer.
+func (m *Metrics) FrameSent(size int) {
+	m.frames.WithLabelValues("out").Inc()
+	m.bytes.WithLabelValues("out").Add(float64(size))
+}
+
+// FrameReceived implements protocol.Observer.
+func (m *Metrics) FrameReceived(size int) {
+	m.frames.WithLabelValues("in").Inc()
+	m.bytes.WithLabelValues("in").Add(float64(size))
+}
+
+// poolCollector collect the handler pool of the instrumented workers.
+type poolCollector struct {
+	m *Metrics
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.poolSize
+	ch <- c.m.poolWaiting
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.locker.RLock()
+	defer c.m.locker.RUnlock()
+	for i, w := range c.m.workers {
+		label := strconv.Itoa(i)
+		ch <- prometheus.MustNewConstMetric(c.m.poolSize, prometheus.GaugeValue, float64(w.Size()), label)
+		ch <- prometheus.MustNewConstMetric(c.m.poolWaiting, prometheus.GaugeValue, float64(w.WaitingQueueSize()), label)
+	}
+}
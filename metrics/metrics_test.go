@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/Lupino/go-periodic"
+	"github.com/Lupino/go-periodic/protocol"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.InstrumentWorker(periodic.NewWorker(4))
+
+	m.ObserveJobReceived("test")
+	m.ObserveJobHandled("test", 10*time.Millisecond)
+	m.ObserveJobFinished("test", protocol.WORKDONE)
+	m.ObserveCommand(protocol.SUBMITJOB, protocol.SUCCESS, time.Millisecond, nil)
+	m.ObserveCommand(protocol.RUNJOB, protocol.NO_WORKER, time.Millisecond, nil)
+	m.FrameSent(10)
+	m.FrameReceived(20)
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	rsp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	body, _ := io.ReadAll(rsp.Body)
+
+	for _, line := range []string{
+		`periodic_worker_jobs_total{func="test",status="received"} 1`,
+		`periodic_worker_jobs_total{func="test",status="done"} 1`,
+		`periodic_worker_jobs_inflight{func="test"} 0`,
+		`periodic_worker_handler_duration_seconds_count{func="test"} 1`,
+		`periodic_worker_pool_size{worker="0"} 4`,
+		`periodic_worker_pool_waiting{worker="0"} 0`,
+		`periodic_client_request_duration_seconds_count{command="SUBMITJOB"} 1`,
+		`periodic_client_request_errors_total{command="RUNJOB",reason="NO_WORKER"} 1`,
+		`periodic_conn_bytes_total{direction="out"} 10`,
+		`periodic_conn_frames_total{direction="in"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("metrics: except %s, got:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package periodic_test
+
+import (
+	"github.com/Lupino/go-periodic"
+	"github.com/Lupino/go-periodic/metrics"
+	"github.com/Lupino/go-periodic/types"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerMetrics(t *testing.T) {
+	s := periodic.NewFakeServer(t)
+	s.Assign(
+		types.Job{Func: "ok", Name: "done"},
+		types.Job{Func: "ok", Name: "bad", Args: "\x00GZPnot gzip"},
+		types.Job{Func: "missing", Name: "job"},
+	)
+	m := metrics.New()
+	w := periodic.NewWorker(2)
+	w.SetLogger(periodic.NopLogger{})
+	m.InstrumentWorker(w)
+	if err := w.Connect(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.AddFunc("ok", func(job periodic.Job) {
+		job.Done()
+	})
+	go w.Work()
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	lines := []string{
+		`periodic_worker_jobs_total{func="ok",status="received"} 2`,
+		`periodic_worker_jobs_total{func="ok",status="done"} 1`,
+		`periodic_worker_jobs_total{func="ok",status="failed"} 1`,
+		`periodic_worker_jobs_total{func="missing",status="failed"} 1`,
+		`periodic_worker_jobs_inflight{func="ok"} 0`,
+		`periodic_worker_handler_duration_seconds_count{func="ok"} 2`,
+	}
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rsp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		body = string(data)
+		missing := false
+		for _, line := range lines {
+			if !strings.Contains(body, line) {
+				missing = true
+			}
+		}
+		if !missing {
+			break
+		}
+	}
+	for _, line := range lines {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics: except %s, got:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `periodic_worker_jobs_inflight{func="missing"} 1`) {
+		t.Errorf("metrics: the unknown func job is inflight:\n%s", body)
+	}
+}
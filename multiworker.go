@@ -0,0 +1,212 @@
+package periodic
+
+import (
+	"github.com/gammazero/workerpool"
+	"sync"
+	"time"
+)
+
+// MultiWorker defined a worker pull jobs from several periodic servers.
+// The handlers share one bounded pool, the jobs are grabbed fairly from
+// each server and reported to the server they came from.
+type MultiWorker struct {
+	workers []*Worker
+	wp      *workerpool.WorkerPool
+	setup   []func(*Worker)
+	done    chan struct{}
+	closed  *sync.Once
+}
+
+// NewMultiWorker create a multi worker with a handler pool of size,
+// setup is called on each worker before connect, eg. to set a logger.
+func NewMultiWorker(size int, setup ...func(*Worker)) *MultiWorker {
+	return &MultiWorker{
+		wp:     workerpool.New(size),
+		setup:  setup,
+		done:   make(chan struct{}),
+		closed: new(sync.Once),
+	}
+}
+
+// Connect the periodic servers. The unreachable servers are connected in
+// background, an error is returned only when none of them is reachable.
+func (mw *MultiWorker) Connect(addrs []string, key ...string) error {
+	var lastErr error
+	connected := 0
+	for _, addr := range addrs {
+		w := newWorker(mw.wp)
+		for _, fn := range mw.setup {
+			fn(w)
+		}
+		if err := w.Connect(addr, key...); err != nil {
+			lastErr = err
+			if err := w.connectLater(addr, key...); err != nil {
+				mw.Close()
+				return err
+			}
+		} else {
+			connected++
+		}
+		mw.workers = append(mw.workers, w)
+	}
+	if connected == 0 && lastErr != nil {
+		mw.Close()
+		return lastErr
+	}
+	return nil
+}
+
+// Workers return the worker of each server.
+func (mw *MultiWorker) Workers() []*Worker {
+	return mw.workers
+}
+
+// Use add middlewares to all the workers, see Worker.Use.
+func (mw *MultiWorker) Use(middlewares ...Middleware) {
+	for _, w := range mw.workers {
+		w.Use(middlewares...)
+	}
+	mw.setup = append(mw.setup, func(w *Worker) {
+		w.Use(middlewares...)
+	})
+}
+
+// SetRetryPolicy set the retry policy of a func on all the workers, see
+// Worker.SetRetryPolicy.
+func (mw *MultiWorker) SetRetryPolicy(funcName string, policy RetryPolicy) {
+	for _, w := range mw.workers {
+		w.SetRetryPolicy(funcName, policy)
+	}
+	mw.setup = append(mw.setup, func(w *Worker) {
+		w.SetRetryPolicy(funcName, policy)
+	})
+}
+
+// SetResultStore set the result store of all the workers, see
+// Client.SetResultStore.
+func (mw *MultiWorker) SetResultStore(store ResultStore) {
+	for _, w := range mw.workers {
+		w.SetResultStore(store)
+	}
+	mw.setup = append(mw.setup, func(w *Worker) {
+		w.SetResultStore(store)
+	})
+}
+
+// SetProgressSink set the progress sink of all the workers, see
+// Worker.SetProgressSink.
+func (mw *MultiWorker) SetProgressSink(sink ProgressSink) {
+	for _, w := range mw.workers {
+		w.SetProgressSink(sink)
+	}
+	mw.setup = append(mw.setup, func(w *Worker) {
+		w.SetProgressSink(sink)
+	})
+}
+
+// SetHeartbeat set the heartbeat of all the workers, see
+// Worker.SetHeartbeat.
+func (mw *MultiWorker) SetHeartbeat(interval time.Duration) {
+	for _, w := range mw.workers {
+		w.SetHeartbeat(interval)
+	}
+	mw.setup = append(mw.setup, func(w *Worker) {
+		w.SetHeartbeat(interval)
+	})
+}
+
+// AddFunc to all the periodic servers. The func is registered to the
+// disconnected servers once they are connected.
+func (mw *MultiWorker) AddFunc(funcName string, task func(Job)) error {
+	return mw.each(func(w *Worker) error {
+		err := w.AddFunc(funcName, task)
+		if err == ErrNotConnected {
+			w.tasks[funcName] = task
+			return nil
+		}
+		return err
+	})
+}
+
+// Broadcast to all the periodic servers, see Worker.Broadcast.
+func (mw *MultiWorker) Broadcast(funcName string, task func(Job)) error {
+	return mw.each(func(w *Worker) error {
+		err := w.Broadcast(funcName, task)
+		if err == ErrNotConnected {
+			w.tasks[funcName] = task
+			w.broadcasts[funcName] = true
+			return nil
+		}
+		return err
+	})
+}
+
+// RemoveFunc from all the periodic servers.
+func (mw *MultiWorker) RemoveFunc(funcName string) error {
+	return mw.each(func(w *Worker) error {
+		err := w.RemoveFunc(funcName)
+		if err == ErrNotConnected {
+			delete(w.tasks, funcName)
+			delete(w.broadcasts, funcName)
+			return nil
+		}
+		return err
+	})
+}
+
+// each call fn on all the workers, return the last error.
+func (mw *MultiWorker) each(fn func(*Worker) error) error {
+	var lastErr error
+	for _, w := range mw.workers {
+		if err := fn(w); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Size return the size of the shared handler pool.
+func (mw *MultiWorker) Size() int {
+	return mw.wp.Size()
+}
+
+// WaitingQueueSize return the count of jobs waiting for a free handler.
+func (mw *MultiWorker) WaitingQueueSize() int {
+	return mw.wp.WaitingQueueSize()
+}
+
+// Work grab the jobs from the servers in turn.
+func (mw *MultiWorker) Work() {
+	for _, w := range mw.workers {
+		w.queueLock.Lock()
+		w.fillAgentQueue()
+		w.queueLock.Unlock()
+	}
+	size := len(mw.workers)
+	if size == 0 {
+		return
+	}
+	next := 0
+	for {
+		for i := 0; i < size; i++ {
+			mw.workers[(next+i)%size].grab()
+		}
+		next = (next + 1) % size
+		select {
+		case <-mw.done:
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// Close all the workers and stop the handler pool.
+func (mw *MultiWorker) Close() {
+	mw.closed.Do(func() {
+		close(mw.done)
+		for _, w := range mw.workers {
+			w.Close()
+		}
+		mw.wp.Stop()
+	})
+}
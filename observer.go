@@ -0,0 +1,32 @@
+package periodic
+
+import (
+	"github.com/Lupino/go-periodic/protocol"
+	"time"
+)
+
+// Observer receive the client and worker events, eg. to collect metrics.
+// If the observer also implements protocol.Observer, it receive the frames
+// of the connection too.
+type Observer interface {
+	// ObserveCommand called after a command round trip,
+	// ret is the reply command from server.
+	ObserveCommand(cmd, ret protocol.Command, duration time.Duration, err error)
+	// ObserveJobReceived called when a worker start to handle a job.
+	ObserveJobReceived(funcName string)
+	// ObserveJobHandled called when a worker handler return.
+	ObserveJobHandled(funcName string, duration time.Duration)
+	// ObserveJobFinished called when a job is reported to server,
+	// status is one of WORKDONE, WORKFAIL and SCHEDLATER.
+	ObserveJobFinished(funcName string, status protocol.Command)
+}
+
+// SetObserver set the client observer, must be set before Connect.
+func (c *Client) SetObserver(observer Observer) {
+	c.observer = observer
+}
+
+// Observer return the client observer.
+func (c *Client) Observer() Observer {
+	return c.observer
+}
@@ -0,0 +1,207 @@
+package periodic
+
+import (
+	"errors"
+	"github.com/Lupino/go-periodic/types"
+	"sync"
+	"sync/atomic"
+)
+
+var _ ClientI = new(ClientPool)
+
+// ErrNoClient error on the pool have no connected client
+var ErrNoClient = errors.New("No connected client")
+
+// ClientPool defined a pool of clients connect to the same server,
+// the requests are balanced over the connected clients.
+// A lost connection is skipped until it is reconnected by its client.
+type ClientPool struct {
+	clients []*Client
+	next    uint32
+}
+
+// NewClientPool create a client pool of size clients,
+// setup is called on each client before connect, eg. to set a logger.
+func NewClientPool(size int, setup ...func(*Client)) *ClientPool {
+	if size < 1 {
+		size = 1
+	}
+	p := new(ClientPool)
+	p.clients = make([]*Client, size)
+	for i := range p.clients {
+		c := NewClient()
+		for _, fn := range setup {
+			fn(c)
+		}
+		p.clients[i] = c
+	}
+	return p
+}
+
+// Connect all the clients to a periodic server.
+func (p *ClientPool) Connect(addr string, key ...string) error {
+	for i, c := range p.clients {
+		if err := c.Connect(addr, key...); err != nil {
+			for _, connected := range p.clients[:i] {
+				connected.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Clients return the clients of the pool.
+func (p *ClientPool) Clients() []*Client {
+	return p.clients
+}
+
+// Size return the size of the pool.
+func (p *ClientPool) Size() int {
+	return len(p.clients)
+}
+
+// Healthy return true when one of the clients is healthy.
+func (p *ClientPool) Healthy() bool {
+	for _, c := range p.clients {
+		if c.Healthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// pick the next connected client by round robin, prefer a healthy one.
+func (p *ClientPool) pick() (*Client, error) {
+	size := uint32(len(p.clients))
+	start := atomic.AddUint32(&p.next, 1)
+	var connected *Client
+	for i := uint32(0); i < size; i++ {
+		c := p.clients[(start+i)%size]
+		if !c.isConnected() {
+			continue
+		}
+		if c.Healthy() {
+			return c, nil
+		}
+		if connected == nil {
+			connected = c
+		}
+	}
+	if connected != nil {
+		return connected, nil
+	}
+	return nil, ErrNoClient
+}
+
+// Ping a periodic server.
+func (p *ClientPool) Ping() bool {
+	c, err := p.pick()
+	if err != nil {
+		return false
+	}
+	return c.Ping()
+}
+
+// SubmitJob to periodic server, see Client.SubmitJob.
+func (p *ClientPool) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	c, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return c.SubmitJob(funcName, name, opts)
+}
+
+// SubmitJobs split the jobs over the connected clients, see Client.SubmitJobs.
+func (p *ClientPool) SubmitJobs(jobs []types.Job) []error {
+	return p.split(len(jobs), func(c *Client, start, end int) []error {
+		return c.SubmitJobs(jobs[start:end])
+	})
+}
+
+// RemoveJobs split the jobs over the connected clients, see Client.RemoveJobs.
+// The concurrency is per connection.
+func (p *ClientPool) RemoveJobs(funcName string, names []string, concurrency int) []error {
+	return p.split(len(names), func(c *Client, start, end int) []error {
+		return c.RemoveJobs(funcName, names[start:end], concurrency)
+	})
+}
+
+// split size requests in chunks run concurrently on the connected clients.
+func (p *ClientPool) split(size int, run func(c *Client, start, end int) []error) []error {
+	errs := make([]error, size)
+	var clients []*Client
+	for _, c := range p.clients {
+		if c.isConnected() {
+			clients = append(clients, c)
+		}
+	}
+	if len(clients) == 0 {
+		for i := range errs {
+			errs[i] = ErrNoClient
+		}
+		return errs
+	}
+	chunk := (size + len(clients) - 1) / len(clients)
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		start := i * chunk
+		if start >= size {
+			break
+		}
+		end := start + chunk
+		if end > size {
+			end = size
+		}
+		wg.Add(1)
+		go func(c *Client, start, end int) {
+			defer wg.Done()
+			copy(errs[start:end], run(c, start, end))
+		}(c, start, end)
+	}
+	wg.Wait()
+	return errs
+}
+
+// RunJob to periodic server and get an result, see Client.RunJob.
+func (p *ClientPool) RunJob(funcName, name string, opts map[string]interface{}) (error, []byte) {
+	c, err := p.pick()
+	if err != nil {
+		return err, nil
+	}
+	return c.RunJob(funcName, name, opts)
+}
+
+// Status return a status from periodic server.
+func (p *ClientPool) Status() ([][]string, error) {
+	c, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+	return c.Status()
+}
+
+// DropFunc drop unuseful function from periodic server.
+func (p *ClientPool) DropFunc(funcName string) error {
+	c, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return c.DropFunc(funcName)
+}
+
+// RemoveJob to periodic server.
+func (p *ClientPool) RemoveJob(funcName, name string) error {
+	c, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return c.RemoveJob(funcName, name)
+}
+
+// Close all the clients.
+func (p *ClientPool) Close() {
+	for _, c := range p.clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,338 @@
+package periodic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic/protocol"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported error on the server do not support the command.
+var ErrNotSupported = errors.New("Command not supported by the server")
+
+// Progress defined the intermediate status of a running job.
+type Progress struct {
+	Func    string       `json:"func"`
+	Name    string       `json:"name"`
+	Percent int          `json:"percent"`
+	Message string       `json:"message,omitempty"`
+	Status  ResultStatus `json:"status,omitempty"` // set when the job is finished
+	Time    time.Time    `json:"time"`
+}
+
+// Finished return true when the job is finished.
+func (p Progress) Finished() bool {
+	return p.Status != ""
+}
+
+// ProgressSink defined where the workers report the job progress.
+type ProgressSink interface {
+	Report(progress Progress) error
+}
+
+// ProgressFunc adapt a func to a ProgressSink.
+type ProgressFunc func(progress Progress) error
+
+// Report call the func.
+func (fn ProgressFunc) Report(progress Progress) error {
+	return fn(progress)
+}
+
+// ProgressSource defined where the clients watch the job progress.
+type ProgressSource interface {
+	Watch(ctx context.Context, funcName, name string) (<-chan Progress, error)
+}
+
+// progressStream a progress channel never block the sender, the oldest
+// progress is dropped when the receiver is slow.
+type progressStream struct {
+	locker sync.Mutex
+	ch     chan Progress
+	done   chan struct{}
+	closed bool
+}
+
+func newProgressStream() *progressStream {
+	return &progressStream{
+		ch:   make(chan Progress, 16),
+		done: make(chan struct{}),
+	}
+}
+
+func (s *progressStream) send(p Progress) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- p:
+		return
+	default:
+	}
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.ch <- p
+}
+
+func (s *progressStream) close() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+		close(s.done)
+	}
+}
+
+// ProgressBroker keep the job progress in memory, it is both a ProgressSink
+// and a ProgressSource, eg. for the tests or a client run in the same
+// process as the workers.
+type ProgressBroker struct {
+	locker   sync.Mutex
+	last     map[string]Progress
+	watchers map[string]map[*progressStream]bool
+}
+
+// NewProgressBroker create a progress broker.
+func NewProgressBroker() *ProgressBroker {
+	return &ProgressBroker{
+		last:     make(map[string]Progress),
+		watchers: make(map[string]map[*progressStream]bool),
+	}
+}
+
+// Report the progress to the watchers, they are closed when the job is
+// finished.
+func (b *ProgressBroker) Report(p Progress) error {
+	key := p.Func + "\x00" + p.Name
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	if last, ok := b.last[key]; ok && p.Finished() && p.Status != ResultDone {
+		p.Percent = last.Percent
+	}
+	b.last[key] = p
+	for stream := range b.watchers[key] {
+		stream.send(p)
+		if p.Finished() {
+			stream.close()
+		}
+	}
+	if p.Finished() {
+		delete(b.watchers, key)
+	}
+	return nil
+}
+
+// Watch the progress of a job, the last progress is sent first. The channel
+// is closed when the job is finished or ctx is done.
+func (b *ProgressBroker) Watch(ctx context.Context, funcName, name string) (<-chan Progress, error) {
+	key := funcName + "\x00" + name
+	stream := newProgressStream()
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	if last, ok := b.last[key]; ok {
+		stream.send(last)
+		if last.Finished() {
+			stream.close()
+			return stream.ch, nil
+		}
+	}
+	if b.watchers[key] == nil {
+		b.watchers[key] = make(map[*progressStream]bool)
+	}
+	b.watchers[key][stream] = true
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stream.done:
+			return
+		}
+		b.locker.Lock()
+		delete(b.watchers[key], stream)
+		if len(b.watchers[key]) == 0 {
+			delete(b.watchers, key)
+		}
+		b.locker.Unlock()
+		stream.close()
+	}()
+	return stream.ch, nil
+}
+
+// encodeProgress encode the PROGRESS packet.
+func encodeProgress(handle []byte, percent int, message string) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(handle)
+	buf.WriteByte(byte(percent))
+	buf.WriteString(message)
+	return buf.Bytes()
+}
+
+// decodeProgress decode the PROGRESS packet.
+func decodeProgress(data []byte) (p Progress, err error) {
+	var funcName, name []byte
+	if funcName, data, err = decode8(data); err != nil {
+		return
+	}
+	if name, data, err = decode8(data); err != nil {
+		return
+	}
+	if len(data) < 1 {
+		return p, fmt.Errorf("Invalid progress packet")
+	}
+	p = Progress{
+		Func:    string(funcName),
+		Name:    string(name),
+		Percent: int(data[0]),
+		Message: string(data[1:]),
+		Time:    time.Now(),
+	}
+	return
+}
+
+// decode8 decode a value with 1 byte size.
+func decode8(data []byte) (value, rest []byte, err error) {
+	if len(data) < 1 || len(data) < int(data[0])+1 {
+		return nil, nil, fmt.Errorf("Invalid progress packet")
+	}
+	size := int(data[0]) + 1
+	return data[1:size], data[size:], nil
+}
+
+// SetProgressSink set the progress sink, Job.Progress report to it instead
+// of the periodic server.
+func (w *Worker) SetProgressSink(sink ProgressSink) {
+	w.progress = sink
+}
+
+// Progress report the job progress, percent is from 0 to 100. It is sent to
+// the progress sink of the worker, or by the PROGRESS command to the
+// periodic server when none, ErrNotSupported if the server do not support
+// it.
+func (j *Job) Progress(percent int, message string) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	if j.Worker.progress != nil {
+		return j.Worker.progress.Report(Progress{
+			Func:    j.FuncName,
+			Name:    j.Name,
+			Percent: percent,
+			Message: message,
+			Time:    time.Now(),
+		})
+	}
+	ret, data, err := j.Worker.sendCommandAndReceive(protocol.PROGRESS, encodeProgress(j.Handle, percent, message))
+	if err != nil {
+		return err
+	}
+	switch ret {
+	case protocol.SUCCESS:
+		return nil
+	case protocol.UNKNOWN:
+		return ErrNotSupported
+	}
+	return fmt.Errorf("Progress error: %s", data)
+}
+
+// finish save the job result and report the finished progress to the
+// progress sink.
+func (j *Job) finish(status ResultStatus, output []byte, err error) {
+	j.saveResult(status, output, err)
+	if j.Worker == nil || j.Worker.progress == nil {
+		return
+	}
+	p := Progress{
+		Func:   j.FuncName,
+		Name:   j.Name,
+		Status: status,
+		Time:   time.Now(),
+	}
+	if status == ResultDone {
+		p.Percent = 100
+	}
+	if err != nil {
+		p.Message = err.Error()
+	}
+	if err := j.Worker.progress.Report(p); err != nil {
+		j.Worker.logger.Error("report progress failed", "func", j.FuncName, "job", j.Name, "error", err)
+	}
+}
+
+// SetProgressSource set the progress source, WatchProgress watch it instead
+// of the periodic server.
+func (c *Client) SetProgressSource(source ProgressSource) {
+	c.progress = source
+}
+
+// WatchProgress watch the progress of a job. The channel is closed when the
+// job is finished, ctx is done or the connection is lost. A slow receiver
+// miss the oldest progress. Without a progress source it send the WATCHJOB
+// command to the periodic server, ErrNotSupported if the server do not
+// support it.
+func (c *Client) WatchProgress(ctx context.Context, funcName, name string) (<-chan Progress, error) {
+	if c.progress != nil {
+		return c.progress.Watch(ctx, funcName, name)
+	}
+	if !c.isConnected() {
+		return nil, ErrNotConnected
+	}
+	stream := newProgressStream()
+	first := make(chan error, 1)
+	reply := func(err error) {
+		select {
+		case first <- err:
+		default:
+		}
+	}
+	agent := c.newStreamAgent(func(cmd protocol.Command, data []byte, err error) {
+		switch {
+		case err != nil:
+			reply(err)
+			stream.close()
+		case cmd == protocol.PROGRESS:
+			if p, err := decodeProgress(data); err == nil {
+				stream.send(p)
+			}
+			reply(nil)
+		case cmd == protocol.UNKNOWN:
+			reply(ErrNotSupported)
+			stream.close()
+		default:
+			// the job is finished
+			reply(nil)
+			stream.close()
+		}
+	})
+	if err := agent.Send(protocol.WATCHJOB, append(encode8(funcName), encode8(name)...)); err != nil {
+		c.removeAgent(agent.ID)
+		return nil, err
+	}
+	var err error
+	select {
+	case err = <-first:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.removeAgent(agent.ID)
+		stream.close()
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.removeAgent(agent.ID)
+			stream.close()
+		case <-stream.done:
+		}
+	}()
+	return stream.ch, nil
+}
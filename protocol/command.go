@@ -75,6 +75,17 @@ const (
 	NO_WORKER = 29 // server
 	// DATA run job data
 	DATA = 30 // server
+
+	// PROGRESS report the job progress, push to the watchers
+	PROGRESS Command = 31 // worker or server
+	// WATCHJOB watch the job progress
+	WATCHJOB Command = 32 // client
+	// HEARTBEAT extend the running job timeout
+	HEARTBEAT Command = 33 // worker
+	// SUBMITIFABSENT submit a job when no job has the same name
+	SUBMITIFABSENT Command = 34 // client
+	// JOBEXISTS the job already exists
+	JOBEXISTS Command = 35 // server
 )
 
 // Bytes convert command to byte
@@ -85,6 +96,21 @@ func (c Command) Bytes() []byte {
 }
 
 func (c Command) String() string {
+	if name := c.name(); name != "" {
+		return name
+	}
+	panic("Unknow Command " + strconv.Itoa(int(c)))
+}
+
+// Name return the command name, the command number on unknown command.
+func (c Command) Name() string {
+	if name := c.name(); name != "" {
+		return name
+	}
+	return strconv.Itoa(int(c))
+}
+
+func (c Command) name() string {
 	switch c {
 	case NOOP:
 		return "NOOP"
@@ -146,6 +172,16 @@ func (c Command) String() string {
 		return "NO_WORKER"
 	case DATA:
 		return "DATA"
+	case PROGRESS:
+		return "PROGRESS"
+	case WATCHJOB:
+		return "WATCHJOB"
+	case HEARTBEAT:
+		return "HEARTBEAT"
+	case SUBMITIFABSENT:
+		return "SUBMITIFABSENT"
+	case JOBEXISTS:
+		return "JOBEXISTS"
 	}
-	panic("Unknow Command " + strconv.Itoa(int(c)))
+	return ""
 }
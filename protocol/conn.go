@@ -20,6 +20,14 @@ var (
 	MagicResponse = []byte("\x00RES")
 )
 
+// Observer receive the frames size of a connection, eg. to collect metrics.
+type Observer interface {
+	// FrameSent called after a frame is sent, size is the payload size.
+	FrameSent(size int)
+	// FrameReceived called after a frame is received, size is the payload size.
+	FrameReceived(size int)
+}
+
 // Conn a custom connect
 type Conn struct {
 	net.Conn
@@ -27,6 +35,7 @@ type Conn struct {
 	ResponseMagic []byte
 	wlocker       *sync.RWMutex
 	rlocker       *sync.RWMutex
+	observer      Observer
 }
 
 // NewConn create a connection
@@ -46,6 +55,11 @@ func NewClientConn(conn net.Conn) Conn {
 	return NewConn(conn, MagicResponse, MagicRequest)
 }
 
+// SetObserver set the frames observer, must be set before the connection copied.
+func (conn *Conn) SetObserver(observer Observer) {
+	conn.observer = observer
+}
+
 // Receive waits for a new message on conn, and receives its payload.
 func (conn *Conn) Receive() (rdata []byte, rerr error) {
 	conn.rlocker.RLock()
@@ -86,6 +100,10 @@ func (conn *Conn) Receive() (rdata []byte, rerr error) {
 		return nil, ErrCRCNotMatch
 	}
 
+	if conn.observer != nil {
+		conn.observer.FrameReceived(len(rdata))
+	}
+
 	return
 }
 
@@ -128,6 +146,10 @@ func (conn *Conn) Send(data []byte) error {
 		return err
 	}
 
+	if conn.observer != nil {
+		conn.observer.FrameSent(len(data))
+	}
+
 	return nil
 }
 
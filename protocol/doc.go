@@ -108,6 +108,11 @@ header is:
 	                    28  RELEASE       Worker
 	                    29  NO_WORKER     Client
 	                    30  DATA          Client
+	                    31  PROGRESS      Client/Worker
+	                    32  WATCH_JOB     Client
+	                    33  HEARTBEAT     Worker
+	                    34  SUBMIT_IF_ABSENT Client
+	                    35  JOB_EXISTS    Client
 
 ## Client/Worker Requests
 These request types may be sent by either a client or a worker:
@@ -193,6 +198,24 @@ These request types may only be sent by a client:
 	     Shutdown server.
 	     Arguments:
 	     - None.
+	 SUBMIT_IF_ABSENT
+	     Submit a job only when the function have no job with the same
+	     name, only the Go server support it, the others respond with a
+	     UNKNOWN packet. The server will respond with a SUCCESS packet, or
+	     a JOB_EXISTS packet when the job exists.
+	     Arguments:
+	     - Job binary packet
+	 WATCH_JOB
+	     Watch the progress of a job, only the Go server support it, the
+	     others respond with a UNKNOWN packet. The server will respond with
+	     a PROGRESS packet of the current progress, then a PROGRESS packet on
+	     each report, and a SUCCESS packet when the job is finished or
+	     removed.
+	     Arguments:
+	     - 1 byte func size
+	     - ? byte func name
+	     - 1 byte name size
+	     - ? byte name
 
 ## Client Responses
 These response types may only be sent to a client:
@@ -216,6 +239,16 @@ These response types may only be sent to a client:
 	    This is sent in response to one of the RUN_JOB packets.
 	    Arguments:
 	    - None
+	JOB_EXISTS
+	    This is sent in response to one of the SUBMIT_IF_ABSENT packets.
+	    Arguments:
+	    - None
+	PROGRESS
+	    This is sent in response to one of the WATCH_JOB packets.
+	    Arguments:
+	    - ? byte handle
+	    - 1 byte percent, from 0 to 100
+	    - ? byte message
 
 ## Worker Requests
 These request types may only be sent by a worker:
@@ -288,6 +321,23 @@ These request types may only be sent by a worker:
 	    - 1 byte lock name size
 	    - ? byte lock name
 	    - ? byte handle
+	PROGRESS
+	    This is to report the progress of a job, and push it to the
+	    watchers. Only the Go server support it, the others respond with a
+	    UNKNOWN packet. The server will respond with a SUCCESS packet.
+	    Arguments:
+	    - ? byte handle
+	    - 1 byte percent, from 0 to 100
+	    - ? byte message
+	HEARTBEAT
+	    This is to keep a running job from being reverted. The server
+	    restart the job timeout from now with the given timeout. Only the Go
+	    server support it, the others respond with a UNKNOWN packet. The
+	    server will respond with a SUCCESS packet.
+	    Arguments:
+	    - ? byte handle
+	    - 8 byte timeout in seconds, 0 is the job timeout or the server
+	      timeout when the job have none
 
 ## Worker Responses
 These response types may only be sent to a worker:
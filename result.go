@@ -0,0 +1,179 @@
+package periodic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNoResultStore error on the client have no result store.
+var ErrNoResultStore = errors.New("No result store")
+
+// ErrResultNotFound error on the job have no result.
+var ErrResultNotFound = errors.New("Job result not found")
+
+// ResultStatus defined how a job finished.
+type ResultStatus string
+
+const (
+	// ResultDone the job is done.
+	ResultDone ResultStatus = "done"
+	// ResultFail the job is failed.
+	ResultFail ResultStatus = "fail"
+	// ResultDead the job is moved to the dead-letter func.
+	ResultDead ResultStatus = "dead"
+)
+
+// JobResult defined the result of a finished job.
+type JobResult struct {
+	Func       string       `json:"func"`
+	Name       string       `json:"name"`
+	Status     ResultStatus `json:"status"`
+	Output     []byte       `json:"output,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Counter    int32        `json:"counter"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+}
+
+// ResultStore defined a store of the job results, the last result of a
+// job replace the previous one.
+type ResultStore interface {
+	Save(result JobResult) error
+	Load(funcName, name string) (JobResult, error)
+}
+
+// MemoryResultStore keep the job results in memory, eg. for the tests or a
+// client run in the same process as the workers.
+type MemoryResultStore struct {
+	locker  sync.RWMutex
+	results map[string]JobResult
+}
+
+// NewMemoryResultStore create a memory result store.
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{results: make(map[string]JobResult)}
+}
+
+// Save the result.
+func (s *MemoryResultStore) Save(result JobResult) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.results[result.Func+"\x00"+result.Name] = result
+	return nil
+}
+
+// Load the result of a job, ErrResultNotFound if none.
+func (s *MemoryResultStore) Load(funcName, name string) (JobResult, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+	result, ok := s.results[funcName+"\x00"+name]
+	if !ok {
+		return result, ErrResultNotFound
+	}
+	return result, nil
+}
+
+// FileResultStore keep the job results as json files in a directory, it can
+// be shared by the workers and the clients on a shared filesystem.
+type FileResultStore struct {
+	dir string
+}
+
+// NewFileResultStore create a file result store in dir.
+func NewFileResultStore(dir string) (*FileResultStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileResultStore{dir: dir}, nil
+}
+
+// path return the file of a job result, the names are hashed so any func
+// and job name is a valid file name.
+func (s *FileResultStore) path(funcName, name string) string {
+	sum := sha256.Sum256([]byte(funcName + "\x00" + name))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Save the result, the file is replaced atomically.
+func (s *FileResultStore) Save(result JobResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".result-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(result.Func, result.Name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Load the result of a job, ErrResultNotFound if none.
+func (s *FileResultStore) Load(funcName, name string) (result JobResult, err error) {
+	data, err := os.ReadFile(s.path(funcName, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return result, ErrResultNotFound
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &result)
+	return
+}
+
+// SetResultStore set the result store. A worker save the result of the
+// jobs on Done and Fail, a client read them by JobResult.
+func (c *Client) SetResultStore(store ResultStore) {
+	c.results = store
+}
+
+// ResultStore return the result store, nil if none.
+func (c *Client) ResultStore() ResultStore {
+	return c.results
+}
+
+// JobResult return the result of a finished job from the result store.
+func (c *Client) JobResult(funcName, name string) (JobResult, error) {
+	if c.results == nil {
+		return JobResult{}, ErrNoResultStore
+	}
+	return c.results.Load(funcName, name)
+}
+
+// saveResult save the job result when the worker has a result store.
+func (j *Job) saveResult(status ResultStatus, output []byte, err error) {
+	if j.Worker == nil || j.Worker.results == nil {
+		return
+	}
+	result := JobResult{
+		Func:       j.FuncName,
+		Name:       j.Name,
+		Status:     status,
+		Output:     output,
+		Counter:    j.Raw.Counter,
+		StartedAt:  j.received,
+		FinishedAt: time.Now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if err := j.Worker.results.Save(result); err != nil {
+		j.Worker.logger.Error("save result failed", "func", j.FuncName, "job", j.Name, "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package periodic
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// permanentError an error not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wrap err so the job fail without retry.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent return true when err is wrapped by Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// FinalAction defined what to do with a job when the retries are exhausted.
+type FinalAction int
+
+const (
+	// FinalFail tell periodic server the job fail.
+	FinalFail FinalAction = iota
+	// FinalDeadLetter move the job to the dead-letter func, see DeadLetterFunc.
+	FinalDeadLetter
+)
+
+// RetryPolicy defined how the failed jobs of a func are retried.
+// The attempts are counted by the job counter, a retry is a SchedLater with
+// the counter increased.
+type RetryPolicy struct {
+	MaxAttempts  int                  // the attempts include the first run, less than 1 is no limit
+	InitialDelay time.Duration        // the delay before the first retry, the default is 1s
+	MaxDelay     time.Duration        // the max delay, 0 is no limit
+	Multiplier   float64              // the delay multiplier per attempt, the default is 2
+	Jitter       float64              // randomize the delay by up to this fraction, from 0 to 1
+	Retryable    func(err error) bool // return false to not retry an error, nil retry all
+	Final        FinalAction          // the action when the retries are exhausted
+	DeadLetter   string               // the dead-letter func, the default is DeadLetterFunc
+}
+
+// Backoff return the delay before the retry of the attempt, from 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.InitialDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	backoff := float64(delay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		backoff -= backoff * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// retryable return true when the job failed by err should be retried.
+func (p RetryPolicy) retryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	if err != nil && p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return true
+}
+
+// apply the policy on the job failure.
+func (p RetryPolicy) apply(job Job, err error) error {
+	attempt := int(job.Raw.Counter) + 1
+	if p.retryable(err) && (p.MaxAttempts < 1 || attempt < p.MaxAttempts) {
+		delay := int(math.Ceil(p.Backoff(attempt).Seconds()))
+		job.Worker.logger.Debug("retry job", "func", job.FuncName, "job", job.Name, "attempt", attempt, "delay", delay, "error", err)
+		return job.SchedLater(delay, 1)
+	}
+	if p.Final == FinalDeadLetter {
+		deadFunc := p.DeadLetter
+		if deadFunc == "" {
+			deadFunc = DeadLetterFunc(job.FuncName)
+		}
+		return job.deadLetter(deadFunc, err)
+	}
+	return job.FailWith(err)
+}
+
+// SetRetryPolicy set the retry policy of a func, the jobs of the func are
+// retried when the handler call Fail or FailWith. Use the DeadLetterPolicy
+// to move the failed jobs to the dead-letter func without retry.
+func (w *Worker) SetRetryPolicy(funcName string, policy RetryPolicy) {
+	w.retries[funcName] = policy
+}
@@ -0,0 +1,254 @@
+/*
+Package tracing trace periodic clients and workers with opentelemetry.
+
+The trace context of the submitter is propagated to the worker by an
+envelope around the job args, the worker middleware remove the envelope
+before the handler see the args.
+
+	client := tracing.NewClient(periodicClient)
+	client.SubmitJobContext(ctx, "funcName", "name", opts)
+
+	worker.Use(tracing.Middleware())
+*/
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/Lupino/go-periodic"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Lupino/go-periodic/tracing"
+
+// MagicEnvelope the prefix of the args carry a trace context.
+var MagicEnvelope = []byte("\x00TRC")
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option configure the tracing.
+type Option func(*config)
+
+// WithTracerProvider set the tracer provider, the default is the global one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.provider = provider
+	}
+}
+
+// WithPropagator set the propagator, the default is W3C trace context.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(cfg *config) {
+		cfg.propagator = propagator
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func (cfg config) tracer() trace.Tracer {
+	return cfg.provider.Tracer(instrumentationName)
+}
+
+// Inject wrap the args with an envelope carry the trace context of ctx.
+func Inject(ctx context.Context, args string, propagator propagation.TextMapPropagator) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return args
+	}
+	header, err := json.Marshal(carrier)
+	if err != nil || len(header) > 0xFFFF {
+		return args
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.Write(MagicEnvelope)
+	h16 := make([]byte, 2)
+	binary.BigEndian.PutUint16(h16, uint16(len(header)))
+	buf.Write(h16)
+	buf.Write(header)
+	buf.WriteString(args)
+	return buf.String()
+}
+
+// Extract unwrap the args envelope, return the context with the remote
+// trace context and the original args.
+// The args without envelope is returned as is.
+func Extract(ctx context.Context, args string, propagator propagation.TextMapPropagator) (context.Context, string) {
+	payload := []byte(args)
+	if !bytes.HasPrefix(payload, MagicEnvelope) {
+		return ctx, args
+	}
+	payload = payload[len(MagicEnvelope):]
+	if len(payload) < 2 {
+		return ctx, args
+	}
+	length := int(binary.BigEndian.Uint16(payload[0:2]))
+	payload = payload[2:]
+	if len(payload) < length {
+		return ctx, args
+	}
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal(payload[0:length], &carrier); err != nil {
+		return ctx, args
+	}
+	return propagator.Extract(ctx, carrier), string(payload[length:])
+}
+
+// Middleware return a worker middleware start a span around the handler,
+// the span is a child of the submitter span.
+func Middleware(opts ...Option) periodic.Middleware {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+	return func(task func(periodic.Job)) func(periodic.Job) {
+		return func(job periodic.Job) {
+			ctx, args := Extract(job.Context(), job.Args, cfg.propagator)
+			job.Args = args
+			job.Raw.Args = args
+			ctx, span := tracer.Start(ctx, "periodic.handle "+job.FuncName,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(jobAttributes(job.FuncName, job.Name)...),
+				trace.WithAttributes(attribute.Int("periodic.job.counter", int(job.Raw.Counter))),
+			)
+			defer span.End()
+			task(job.WithContext(ctx))
+		}
+	}
+}
+
+func jobAttributes(funcName, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("periodic.func", funcName),
+		attribute.String("periodic.job", name),
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Client wrap a periodic client to trace the calls and propagate the trace
+// context to the workers.
+type Client struct {
+	periodic.ClientI
+	cfg    config
+	tracer trace.Tracer
+}
+
+// NewClient create a tracing client.
+func NewClient(c periodic.ClientI, opts ...Option) *Client {
+	cfg := newConfig(opts)
+	return &Client{ClientI: c, cfg: cfg, tracer: cfg.tracer()}
+}
+
+// injectArgs return a copy of opts with the args wrapped by an envelope.
+func (c *Client) injectArgs(ctx context.Context, opts map[string]interface{}) map[string]interface{} {
+	newOpts := make(map[string]interface{}, len(opts)+1)
+	for k, v := range opts {
+		newOpts[k] = v
+	}
+	var args string
+	switch v := opts["args"].(type) {
+	case string:
+		args = v
+	case []byte:
+		args = string(v)
+	}
+	newOpts["args"] = Inject(ctx, args, c.cfg.propagator)
+	return newOpts
+}
+
+// Ping a periodic server.
+func (c *Client) Ping() bool {
+	_, span := c.tracer.Start(context.Background(), "periodic.ping", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	return c.ClientI.Ping()
+}
+
+// SubmitJob to periodic server.
+func (c *Client) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	return c.SubmitJobContext(context.Background(), funcName, name, opts)
+}
+
+// SubmitJobContext submit job with the span as a child of ctx.
+func (c *Client) SubmitJobContext(ctx context.Context, funcName, name string, opts map[string]interface{}) error {
+	ctx, span := c.tracer.Start(ctx, "periodic.submit "+funcName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(jobAttributes(funcName, name)...),
+	)
+	err := c.ClientI.SubmitJob(funcName, name, c.injectArgs(ctx, opts))
+	endSpan(span, err)
+	return err
+}
+
+// RunJob to periodic server and get an result.
+func (c *Client) RunJob(funcName, name string, opts map[string]interface{}) (error, []byte) {
+	return c.RunJobContext(context.Background(), funcName, name, opts)
+}
+
+// RunJobContext run job with the span as a child of ctx.
+func (c *Client) RunJobContext(ctx context.Context, funcName, name string, opts map[string]interface{}) (error, []byte) {
+	ctx, span := c.tracer.Start(ctx, "periodic.run "+funcName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(jobAttributes(funcName, name)...),
+	)
+	err, ret := c.ClientI.RunJob(funcName, name, c.injectArgs(ctx, opts))
+	endSpan(span, err)
+	return err, ret
+}
+
+// Status return a status from periodic server.
+func (c *Client) Status() ([][]string, error) {
+	_, span := c.tracer.Start(context.Background(), "periodic.status", trace.WithSpanKind(trace.SpanKindClient))
+	stats, err := c.ClientI.Status()
+	endSpan(span, err)
+	return stats, err
+}
+
+// DropFunc drop unuseful function from periodic server.
+func (c *Client) DropFunc(funcName string) error {
+	_, span := c.tracer.Start(context.Background(), "periodic.drop "+funcName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("periodic.func", funcName)),
+	)
+	err := c.ClientI.DropFunc(funcName)
+	endSpan(span, err)
+	return err
+}
+
+// RemoveJob to periodic server.
+func (c *Client) RemoveJob(funcName, name string) error {
+	return c.RemoveJobContext(context.Background(), funcName, name)
+}
+
+// RemoveJobContext remove job with the span as a child of ctx.
+func (c *Client) RemoveJobContext(ctx context.Context, funcName, name string) error {
+	_, span := c.tracer.Start(ctx, "periodic.remove "+funcName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(jobAttributes(funcName, name)...),
+	)
+	err := c.ClientI.RemoveJob(funcName, name)
+	endSpan(span, err)
+	return err
+}
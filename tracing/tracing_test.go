@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"github.com/Lupino/go-periodic"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+// fakeClient keep the submitted args.
+type fakeClient struct {
+	periodic.ClientI
+	args string
+}
+
+func (c *fakeClient) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	c.args, _ = opts["args"].(string)
+	return nil
+}
+
+func TestPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	fake := new(fakeClient)
+	client := NewClient(fake, WithTracerProvider(provider))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "api")
+	opts := map[string]interface{}{"args": "payload"}
+	if err := client.SubmitJobContext(ctx, "test", "job", opts); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	if opts["args"] != "payload" {
+		t.Fatalf("opts args: except payload, got %s", opts["args"])
+	}
+
+	var handled periodic.Job
+	task := Middleware(WithTracerProvider(provider))(func(job periodic.Job) {
+		handled = job
+	})
+	task(periodic.Job{FuncName: "test", Name: "job", Args: fake.args})
+
+	if handled.Args != "payload" {
+		t.Fatalf("handler args: except payload, got %q", handled.Args)
+	}
+	handlerSpan := trace.SpanContextFromContext(handled.Context())
+	if handlerSpan.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatalf("trace id: except %s, got %s", parent.SpanContext().TraceID(), handlerSpan.TraceID())
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("spans: except 3, got %d", len(spans))
+	}
+	submit, handle := spans[0], spans[2]
+	if submit.Name != "periodic.submit test" || handle.Name != "periodic.handle test" {
+		t.Fatalf("span names: got %s, %s", submit.Name, handle.Name)
+	}
+	if handle.Parent.SpanID() != submit.SpanContext.SpanID() {
+		t.Fatalf("handle parent: except %s, got %s", submit.SpanContext.SpanID(), handle.Parent.SpanID())
+	}
+}
+
+func TestExtractPlainArgs(t *testing.T) {
+	ctx := context.Background()
+	gotCtx, args := Extract(ctx, "plain", propagation.TraceContext{})
+	if args != "plain" || gotCtx != ctx {
+		t.Fatalf("Extract plain args: got %q", args)
+	}
+}
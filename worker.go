@@ -6,45 +6,134 @@ import (
 	"github.com/Lupino/go-periodic/protocol"
 	"github.com/gammazero/deque"
 	"github.com/gammazero/workerpool"
+	"sync"
 	"time"
 )
 
+// Middleware wrap a job handler, eg. to trace or retry the job.
+type Middleware func(func(Job)) func(Job)
+
 // Worker defined a client.
 type Worker struct {
 	Client
-	tasks      map[string]func(Job)
-	agentQueue *deque.Deque[*Agent]
-	wp         *workerpool.WorkerPool
+	middlewares []Middleware
+	tasks       map[string]func(Job)
+	broadcasts  map[string]bool
+	retries     map[string]RetryPolicy
+	progress    ProgressSink
+	heartbeat   time.Duration
+	agentQueue  *deque.Deque[*Agent]
+	queueLock   *sync.Mutex
+	wp          *workerpool.WorkerPool
 }
 
 // NewWorker create a client.
 func NewWorker(size int) *Worker {
+	return newWorker(workerpool.New(size))
+}
+
+// newWorker create a worker run the jobs on the handler pool.
+func newWorker(wp *workerpool.WorkerPool) *Worker {
 	w := new(Worker)
+	w.connState = new(connState)
+	w.locker = new(sync.RWMutex)
+	w.health = newHealth()
+	w.logger = DefaultLogger
 	w.tasks = make(map[string]func(Job))
+	w.broadcasts = make(map[string]bool)
+	w.retries = make(map[string]RetryPolicy)
 	w.processTask = func(msgId string, data []byte) {
-		agent := NewAgent(w.conn, []byte(msgId))
+		agent := NewAgent(w.getConn(), []byte(msgId))
 		agent.Send(protocol.GRABJOB, nil)
 		job, err := NewJob(w, data)
 		if err != nil {
+			w.logger.Error("decode job failed", "agent", fmt.Sprintf("%x", msgId), "error", err)
 			return
 		}
+		job.received = time.Now()
+		if policy, ok := w.retries[job.FuncName]; ok {
+			// the middlewares may change the raw args, keep the original
+			// ones for the dead-letter
+			rawArgs := job.Raw.Args
+			job = job.WithFail(func(job Job, err error) error {
+				job.Raw.Args = rawArgs
+				return policy.apply(job, err)
+			})
+		}
 		task, ok := w.tasks[job.FuncName]
 		if ok {
-			w.wp.Submit(func() {
-				task(job)
-			})
-		} else {
-			w.RemoveFunc(job.FuncName)
-			job.Fail()
+			for i := len(w.middlewares) - 1; i >= 0; i-- {
+				task = w.middlewares[i](task)
+			}
 		}
+		// the job is acknowledged out of the receive loop, the replies are
+		// read by it
+		w.wp.Submit(func() {
+			if !ok {
+				w.logger.Warn("func not found", "func", job.FuncName, "job", job.Name)
+				w.RemoveFunc(job.FuncName)
+				job.Fail()
+				return
+			}
+			if w.observer != nil {
+				w.observer.ObserveJobReceived(job.FuncName)
+				start := time.Now()
+				defer func() {
+					w.observer.ObserveJobHandled(job.FuncName, time.Since(start))
+				}()
+			}
+			if err := job.decompress(); err != nil {
+				w.logger.Error("decompress args failed", "func", job.FuncName, "job", job.Name, "error", err)
+				job.FailWith(Permanent(err))
+				return
+			}
+			stop := w.keepAlive(job)
+			defer stop()
+			task(job)
+		})
 	}
 
-	w.agentQueue = deque.New[*Agent](size)
-	w.wp = workerpool.New(size)
+	w.reconnected = w.restore
+
+	w.agentQueue = deque.New[*Agent](wp.Size())
+	w.queueLock = new(sync.Mutex)
+	w.wp = wp
 
 	return w
 }
 
+// restore the registered funcs and the grab agents after reconnect.
+func (w *Worker) restore() {
+	for funcName := range w.tasks {
+		cmd := protocol.CANDO
+		if w.broadcasts[funcName] {
+			cmd = protocol.BROADCAST
+		}
+		ret, data, err := w.sendCommandAndReceive(cmd, encode8(funcName))
+		if err == nil && ret != protocol.SUCCESS {
+			err = fmt.Errorf("%s", data)
+		}
+		if err != nil {
+			w.logger.Error("restore func failed", "func", funcName, "command", cmd.Name(), "error", err)
+		}
+	}
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	if w.agentQueue.Len() == 0 {
+		return
+	}
+	w.agentQueue.Clear()
+	w.fillAgentQueue()
+}
+
+// fillAgentQueue create the grab agents, one per pool slot.
+func (w *Worker) fillAgentQueue() {
+	for i := 0; i < w.wp.Size(); i++ {
+		var agent = w.newAgent()
+		w.agentQueue.PushBack(agent)
+	}
+}
+
 func encode8(dat string) []byte {
 	buf := bytes.NewBuffer(nil)
 	buf.WriteByte(byte(len(dat)))
@@ -52,9 +141,18 @@ func encode8(dat string) []byte {
 	return buf.Bytes()
 }
 
+// Use add middlewares to wrap all the job handlers,
+// the first middleware is the outermost.
+func (w *Worker) Use(middlewares ...Middleware) {
+	w.middlewares = append(w.middlewares, middlewares...)
+}
+
 // AddFunc to periodic server.
 func (w *Worker) AddFunc(funcName string, task func(Job)) error {
-	ret, data, _ := w.sendCommandAndReceive(protocol.CANDO, encode8(funcName))
+	ret, data, err := w.sendCommandAndReceive(protocol.CANDO, encode8(funcName))
+	if err != nil {
+		return err
+	}
 	if ret == protocol.SUCCESS {
 		w.tasks[funcName] = task
 		return nil
@@ -64,9 +162,13 @@ func (w *Worker) AddFunc(funcName string, task func(Job)) error {
 
 // Broadcast to all worker.
 func (w *Worker) Broadcast(funcName string, task func(Job)) error {
-	ret, data, _ := w.sendCommandAndReceive(protocol.BROADCAST, encode8(funcName))
+	ret, data, err := w.sendCommandAndReceive(protocol.BROADCAST, encode8(funcName))
+	if err != nil {
+		return err
+	}
 	if ret == protocol.SUCCESS {
 		w.tasks[funcName] = task
+		w.broadcasts[funcName] = true
 		return nil
 	}
 	return fmt.Errorf("Broadcast error: %s", data)
@@ -74,26 +176,46 @@ func (w *Worker) Broadcast(funcName string, task func(Job)) error {
 
 // RemoveFunc to periodic server.
 func (w *Worker) RemoveFunc(funcName string) error {
-	ret, data, _ := w.sendCommandAndReceive(protocol.CANTDO, encode8(funcName))
+	ret, data, err := w.sendCommandAndReceive(protocol.CANTDO, encode8(funcName))
+	if err != nil {
+		return err
+	}
 	if ret == protocol.SUCCESS {
 		delete(w.tasks, funcName)
+		delete(w.broadcasts, funcName)
 		return nil
 	}
 	return fmt.Errorf("RemoveFunc error: %s", data)
 }
 
+// Size return the size of the handler pool.
+func (w *Worker) Size() int {
+	return w.wp.Size()
+}
+
+// WaitingQueueSize return the count of jobs waiting for a free handler.
+func (w *Worker) WaitingQueueSize() int {
+	return w.wp.WaitingQueueSize()
+}
+
+// grab ask a job with the next grab agent when the pool is not busy.
+func (w *Worker) grab() {
+	w.queueLock.Lock()
+	agent := w.agentQueue.PopFront()
+	w.agentQueue.PushBack(agent)
+	w.queueLock.Unlock()
+	if w.isConnected() && w.wp.WaitingQueueSize() < 1 {
+		agent.Send(protocol.GRABJOB, nil)
+	}
+}
+
 // Work do the task.
 func (w *Worker) Work() {
-	for i := 0; i < w.wp.Size(); i++ {
-		var agent = w.newAgent()
-		w.agentQueue.PushBack(agent)
-	}
-	for {
-		agent := w.agentQueue.PopFront()
-		w.agentQueue.PushBack(agent)
-		if w.wp.WaitingQueueSize() < 1 {
-			agent.Send(protocol.GRABJOB, nil)
-		}
+	w.queueLock.Lock()
+	w.fillAgentQueue()
+	w.queueLock.Unlock()
+	for w.isAlive() {
+		w.grab()
 		select {
 		case <-time.After(1 * time.Second):
 			break
@@ -0,0 +1,502 @@
+// Package workflow run a DAG of steps on periodic, each step is a periodic
+// func, the state is carried in the job args and the status of the steps is
+// kept in a periodic.ResultStore.
+//
+//	wf := workflow.New("order", store)
+//	wf.Step("pay", pay)
+//	wf.Step("stock", stock)
+//	wf.Step("ship", ship, "pay", "stock")
+//	wf.Register(worker)
+//	wf.Start(client, "order-1", input)
+//	status, err := wf.Status("order-1")
+//
+// A step is submitted when its dependencies are done. A step with more than
+// one dependency is submitted by each of them under a lock acquired by
+// Job.Acquire, it run under the same lock once all of them are done, the
+// other jobs are dropped. A step job run again after the step is done only
+// submit the dependents, and it is checked later while the step is running,
+// so the handler is not called twice for a run.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Lupino/go-periodic"
+	"time"
+)
+
+const (
+	// Pending the step is not started.
+	Pending periodic.ResultStatus = "pending"
+	// Running the step is running, or retried after fail.
+	Running periodic.ResultStatus = "running"
+	// Waiting the step is sched later by the handler.
+	Waiting periodic.ResultStatus = "waiting"
+)
+
+// DefaultRunningTimeout the default running timeout of the steps.
+const DefaultRunningTimeout = time.Hour
+
+// recheckDelay the delay in seconds to check a running step again.
+const recheckDelay = 10
+
+// ErrRunNotFound error on the run of a workflow not found.
+var ErrRunNotFound = errors.New("workflow: run not found")
+
+// State defined the state carried between the steps in the job args.
+type State struct {
+	ID      string                     `json:"id"`
+	Input   json.RawMessage            `json:"input,omitempty"`
+	Outputs map[string]json.RawMessage `json:"outputs,omitempty"`
+}
+
+// Decode the input of the run to v.
+func (s State) Decode(v interface{}) error {
+	if len(s.Input) == 0 {
+		return nil
+	}
+	return json.Unmarshal(s.Input, v)
+}
+
+// Output decode the output of a done step to v.
+func (s State) Output(step string, v interface{}) error {
+	output, ok := s.Outputs[step]
+	if !ok {
+		return fmt.Errorf("workflow: no output of step %s", step)
+	}
+	return json.Unmarshal(output, v)
+}
+
+// StepJob defined the job of a step.
+type StepJob struct {
+	periodic.Job
+	Step  string
+	State State
+}
+
+// Handler run a step, the output is encoded as json and passed to the
+// dependent steps. A periodic.SchedLater error sched the step later, any
+// other error fail it by the retry policy of the step func.
+type Handler func(ctx context.Context, job StepJob) (output interface{}, err error)
+
+type step struct {
+	name    string
+	handler Handler
+	deps    []string
+}
+
+// Workflow defined a DAG of steps.
+type Workflow struct {
+	Name  string
+	store periodic.ResultStore
+	steps map[string]*step
+	order []string
+	jobs  jobs
+
+	runningTimeout time.Duration
+}
+
+// jobs defined the operations of a step job on the server.
+type jobs interface {
+	submit(job periodic.Job, funcName, name string, opts map[string]interface{}) error
+	acquire(job periodic.Job, lock string) (bool, error)
+	release(job periodic.Job, lock string)
+	schedLater(job periodic.Job, delay, counter int)
+}
+
+// serverJobs the jobs operations by the job worker.
+type serverJobs struct{}
+
+func (serverJobs) submit(job periodic.Job, funcName, name string, opts map[string]interface{}) error {
+	return job.Worker.SubmitJob(funcName, name, opts)
+}
+
+func (serverJobs) acquire(job periodic.Job, lock string) (bool, error) {
+	err, acquired := job.Acquire(lock, 1)
+	return acquired, err
+}
+
+func (serverJobs) release(job periodic.Job, lock string) {
+	job.Release(lock)
+}
+
+func (serverJobs) schedLater(job periodic.Job, delay, counter int) {
+	job.SchedLater(delay, counter)
+}
+
+// New create a workflow, the step status are saved to store, share it with
+// the clients to query the status.
+func New(name string, store periodic.ResultStore) *Workflow {
+	return &Workflow{
+		Name:  name,
+		store: store,
+		steps: make(map[string]*step),
+		jobs:  serverJobs{},
+
+		runningTimeout: DefaultRunningTimeout,
+	}
+}
+
+// SetRunningTimeout set how long a step is running at most. A step job
+// delivered again while the step is running, eg. after the job timeout on
+// the server, is checked later instead of running the handler twice, until
+// the step is running for timeout, then the step is run again.
+func (wf *Workflow) SetRunningTimeout(timeout time.Duration) {
+	wf.runningTimeout = timeout
+}
+
+// Step add a step run after the deps.
+func (wf *Workflow) Step(name string, handler Handler, deps ...string) *Workflow {
+	wf.steps[name] = &step{name: name, handler: handler, deps: deps}
+	wf.order = append(wf.order, name)
+	return wf
+}
+
+// Func return the periodic func of a step.
+func (wf *Workflow) Func(name string) string {
+	return wf.Name + "." + name
+}
+
+// Validate check the deps exist and have no cycle.
+func (wf *Workflow) Validate() error {
+	if len(wf.steps) == 0 {
+		return errors.New("workflow: no step")
+	}
+	for _, name := range wf.order {
+		for _, dep := range wf.steps[name].deps {
+			if _, ok := wf.steps[dep]; !ok {
+				return fmt.Errorf("workflow: step %s depend on unknown step %s", name, dep)
+			}
+		}
+	}
+	const (
+		visiting = iota + 1
+		visited
+	)
+	marks := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("workflow: cycle on step %s", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range wf.steps[name].deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, name := range wf.order {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register add the step funcs to the worker.
+func (wf *Workflow) Register(w periodic.WorkerI) error {
+	if err := wf.Validate(); err != nil {
+		return err
+	}
+	for _, name := range wf.order {
+		if err := w.AddFunc(wf.Func(name), wf.task(wf.steps[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start a run of id, it submit the steps without deps. The id is the job
+// name of all the steps.
+func (wf *Workflow) Start(c periodic.ClientI, id string, input interface{}) error {
+	if err := wf.Validate(); err != nil {
+		return err
+	}
+	state := State{ID: id}
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("workflow: encode input: %w", err)
+		}
+		state.Input = data
+	}
+	args, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	for _, name := range wf.order {
+		if len(wf.steps[name].deps) > 0 {
+			continue
+		}
+		if err := c.SubmitJob(wf.Func(name), id, map[string]interface{}{"args": args}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunStatus defined the status of a run.
+type RunStatus struct {
+	Workflow string                        `json:"workflow"`
+	ID       string                        `json:"id"`
+	Status   periodic.ResultStatus         `json:"status"`
+	Steps    map[string]periodic.JobResult `json:"steps"`
+}
+
+// Status return the status of a run, ErrRunNotFound if no step started.
+// The run is done when all the steps are done and failed when a step failed.
+func (wf *Workflow) Status(id string) (RunStatus, error) {
+	status := RunStatus{Workflow: wf.Name, ID: id, Steps: make(map[string]periodic.JobResult)}
+	var done, failed, started int
+	for _, name := range wf.order {
+		result, err := wf.load(id, name)
+		if errors.Is(err, periodic.ErrResultNotFound) {
+			result = periodic.JobResult{Status: Pending}
+		} else if err != nil {
+			return status, err
+		}
+		result.Func = wf.Func(name)
+		result.Name = id
+		switch result.Status {
+		case periodic.ResultDone:
+			done++
+		case periodic.ResultFail, periodic.ResultDead:
+			failed++
+		case Running, Waiting:
+			started++
+		}
+		status.Steps[name] = result
+	}
+	switch {
+	case done+failed+started == 0:
+		return status, ErrRunNotFound
+	case failed > 0:
+		status.Status = periodic.ResultFail
+	case done == len(wf.order):
+		status.Status = periodic.ResultDone
+	default:
+		status.Status = Running
+	}
+	return status, nil
+}
+
+// dependents return the steps depend on the step.
+func (wf *Workflow) dependents(name string) (dependents []string) {
+	for _, other := range wf.order {
+		for _, dep := range wf.steps[other].deps {
+			if dep == name {
+				dependents = append(dependents, other)
+				break
+			}
+		}
+	}
+	return
+}
+
+// recordFunc and recordName are the key of the step status in the store,
+// they are not the key of the step job, so the result saved by the worker
+// do not replace it.
+func (wf *Workflow) recordFunc() string {
+	return "workflow/" + wf.Name
+}
+
+func (wf *Workflow) recordName(id, name string) string {
+	return id + "/" + name
+}
+
+func (wf *Workflow) load(id, name string) (periodic.JobResult, error) {
+	return wf.store.Load(wf.recordFunc(), wf.recordName(id, name))
+}
+
+func (wf *Workflow) save(id, name string, result periodic.JobResult) error {
+	result.Func = wf.recordFunc()
+	result.Name = wf.recordName(id, name)
+	return wf.store.Save(result)
+}
+
+// lockName return the lock of a fan-in step, it is held by the job of the
+// step checking the deps and by a dep submitting the step.
+func (wf *Workflow) lockName(id, name string) string {
+	return wf.recordFunc() + "/" + wf.recordName(id, name)
+}
+
+// task return the handler of the step func.
+func (wf *Workflow) task(s *step) func(periodic.Job) {
+	return func(job periodic.Job) {
+		var state State
+		if err := json.Unmarshal([]byte(job.Args), &state); err != nil {
+			job.FailWith(periodic.Permanent(fmt.Errorf("workflow: decode state: %w", err)))
+			return
+		}
+		if state.ID == "" {
+			state.ID = job.Name
+		}
+		if len(s.deps) > 1 {
+			// the step is submitted by each dep, run it once under the lock
+			lock := wf.lockName(state.ID, s.name)
+			acquired, err := wf.jobs.acquire(job, lock)
+			if err != nil {
+				job.FailWith(err)
+				return
+			}
+			if !acquired {
+				// the server run the job again once the lock is released
+				return
+			}
+			defer wf.jobs.release(job, lock)
+		}
+		result, err := wf.load(state.ID, s.name)
+		if err != nil && !errors.Is(err, periodic.ErrResultNotFound) {
+			job.FailWith(err)
+			return
+		}
+		done := err == nil && result.Status == periodic.ResultDone
+		if len(s.deps) > 1 {
+			ok, err := wf.join(s, &state)
+			if err != nil {
+				job.FailWith(err)
+				return
+			}
+			if !ok && !done {
+				// the last dep submit the step again under the lock
+				job.Done()
+				return
+			}
+		}
+		if done {
+			// the job run again after the step is done, eg. it waited the
+			// lock of a dependent, only submit the dependents
+			wf.next(job, s, state, result.Output)
+			return
+		}
+		if result.Status == Running && time.Since(result.StartedAt) < wf.runningTimeout {
+			// the job is delivered again while the step is running
+			wf.jobs.schedLater(job, recheckDelay, 0)
+			return
+		}
+		if err := wf.save(state.ID, s.name, periodic.JobResult{Status: Running, Counter: job.Raw.Counter, StartedAt: time.Now()}); err != nil {
+			job.FailWith(err)
+			return
+		}
+		wf.run(job, s, state)
+	}
+}
+
+// join check the deps of a fan-in step, ok is true when all the deps are
+// done. The outputs of the deps are merged to the state.
+func (wf *Workflow) join(s *step, state *State) (ok bool, err error) {
+	outputs := make(map[string]json.RawMessage)
+	for name, output := range state.Outputs {
+		outputs[name] = output
+	}
+	for _, dep := range s.deps {
+		result, err := wf.load(state.ID, dep)
+		if errors.Is(err, periodic.ErrResultNotFound) || (err == nil && result.Status != periodic.ResultDone) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		outputs[dep] = result.Output
+	}
+	state.Outputs = outputs
+	return true, nil
+}
+
+// run the step handler, save the status and submit the dependents.
+func (wf *Workflow) run(job periodic.Job, s *step, state State) {
+	started := time.Now()
+	output, err := s.handler(job.Context(), StepJob{Job: job, Step: s.name, State: state})
+	var data []byte
+	if err == nil && output != nil {
+		data, err = json.Marshal(output)
+	}
+	var later *periodic.SchedLaterError
+	if errors.As(err, &later) {
+		// the job delivered again is not a running step
+		if err := wf.save(state.ID, s.name, periodic.JobResult{Status: Waiting, Counter: job.Raw.Counter, StartedAt: started}); err != nil {
+			job.FailWith(err)
+			return
+		}
+		wf.jobs.schedLater(job, later.Delay, later.Counter)
+		return
+	}
+	result := periodic.JobResult{
+		Status:     periodic.ResultDone,
+		Output:     data,
+		Counter:    job.Raw.Counter,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = periodic.ResultFail
+		result.Error = err.Error()
+		if err := wf.save(state.ID, s.name, result); err != nil {
+			job.FailWith(err)
+			return
+		}
+		job.FailWith(err)
+		return
+	}
+	// the status is saved before the dependents are submitted, so the last
+	// dep of a fan-in step see all the deps done
+	if err := wf.save(state.ID, s.name, result); err != nil {
+		job.FailWith(err)
+		return
+	}
+	wf.next(job, s, state, data)
+}
+
+// next submit the dependents of a done step and ack the job. A fan-in
+// dependent is submitted under its lock, so the job of it checking the deps
+// at the same time do not drop it by Done.
+func (wf *Workflow) next(job periodic.Job, s *step, state State, data []byte) {
+	next := State{ID: state.ID, Input: state.Input, Outputs: make(map[string]json.RawMessage)}
+	for name, output := range state.Outputs {
+		next.Outputs[name] = output
+	}
+	if data != nil {
+		next.Outputs[s.name] = data
+	}
+	args, err := json.Marshal(next)
+	if err != nil {
+		job.FailWith(err)
+		return
+	}
+	for _, name := range wf.dependents(s.name) {
+		if len(wf.steps[name].deps) > 1 {
+			lock := wf.lockName(state.ID, name)
+			acquired, err := wf.jobs.acquire(job, lock)
+			if err != nil {
+				job.FailWith(err)
+				return
+			}
+			if !acquired {
+				// the server run the job again once the lock is released,
+				// the step is done, so only the dependents are submitted
+				return
+			}
+			err = wf.jobs.submit(job, wf.Func(name), state.ID, map[string]interface{}{"args": args})
+			wf.jobs.release(job, lock)
+			if err != nil {
+				job.FailWith(err)
+				return
+			}
+			continue
+		}
+		if err := wf.jobs.submit(job, wf.Func(name), state.ID, map[string]interface{}{"args": args}); err != nil {
+			// the job run again and submit the dependents
+			job.FailWith(err)
+			return
+		}
+	}
+	job.Done(data)
+}
@@ -0,0 +1,348 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"github.com/Lupino/go-periodic"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeJob struct {
+	funcName string
+	name     string
+	args     string
+}
+
+// fakeWorker run the submitted jobs in memory, the last submitted first.
+// Like the server, a job is keyed by func and name, acknowledge a job remove
+// the queued one of the same name, and a job waiting a lock run again once
+// the lock is released.
+type fakeWorker struct {
+	tasks   map[string]func(periodic.Job)
+	queue   []fakeJob
+	locks   map[string]bool
+	waiting map[string][]fakeJob
+	ran     []string
+	acks    []string
+}
+
+func newFakeWorker(wf *Workflow) *fakeWorker {
+	w := &fakeWorker{
+		tasks:   make(map[string]func(periodic.Job)),
+		locks:   make(map[string]bool),
+		waiting: make(map[string][]fakeJob),
+	}
+	wf.jobs = w
+	return w
+}
+
+func (w *fakeWorker) submit(job periodic.Job, funcName, name string, opts map[string]interface{}) error {
+	return w.SubmitJob(funcName, name, opts)
+}
+
+func (w *fakeWorker) acquire(job periodic.Job, lock string) (bool, error) {
+	if w.locks[lock] {
+		w.waiting[lock] = append(w.waiting[lock], fakeJob{job.FuncName, job.Name, job.Args})
+		return false, nil
+	}
+	w.locks[lock] = true
+	return true, nil
+}
+
+func (w *fakeWorker) schedLater(job periodic.Job, delay, counter int) {
+	w.acks = append(w.acks, "later:"+job.FuncName)
+}
+
+func (w *fakeWorker) release(job periodic.Job, lock string) {
+	delete(w.locks, lock)
+	w.queue = append(w.queue, w.waiting[lock]...)
+	delete(w.waiting, lock)
+}
+
+func (w *fakeWorker) AddFunc(funcName string, task func(periodic.Job)) error {
+	w.tasks[funcName] = task
+	return nil
+}
+
+func (w *fakeWorker) Broadcast(funcName string, task func(periodic.Job)) error {
+	return w.AddFunc(funcName, task)
+}
+
+func (w *fakeWorker) RemoveFunc(funcName string) error {
+	delete(w.tasks, funcName)
+	return nil
+}
+
+func (w *fakeWorker) Ping() bool { return true }
+
+func (w *fakeWorker) SubmitJob(funcName, name string, opts map[string]interface{}) error {
+	args := opts["args"].([]byte)
+	for i, job := range w.queue {
+		if job.funcName == funcName && job.name == name {
+			w.queue[i].args = string(args)
+			return nil
+		}
+	}
+	w.queue = append(w.queue, fakeJob{funcName, name, string(args)})
+	return nil
+}
+
+func (w *fakeWorker) RunJob(string, string, map[string]interface{}) (error, []byte) {
+	return nil, nil
+}
+
+func (w *fakeWorker) Status() ([][]string, error) { return nil, nil }
+
+func (w *fakeWorker) DropFunc(string) error { return nil }
+
+func (w *fakeWorker) RemoveJob(string, string) error { return nil }
+
+func (w *fakeWorker) Close() {}
+
+func (w *fakeWorker) remove(funcName, name string) {
+	for i, job := range w.queue {
+		if job.funcName == funcName && job.name == name {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// take remove the queued job of func from the queue.
+func (w *fakeWorker) take(funcName string) (fakeJob, bool) {
+	for _, job := range w.queue {
+		if job.funcName == funcName {
+			w.remove(job.funcName, job.name)
+			return job, true
+		}
+	}
+	return fakeJob{}, false
+}
+
+func (w *fakeWorker) run(fj fakeJob) {
+	job := periodic.Job{FuncName: fj.funcName, Name: fj.name, Args: fj.args}
+	job = job.WithDone(func(job periodic.Job, data ...[]byte) error {
+		w.acks = append(w.acks, "done:"+job.FuncName)
+		w.remove(job.FuncName, job.Name)
+		return nil
+	}).WithFail(func(job periodic.Job, err error) error {
+		w.acks = append(w.acks, "fail:"+job.FuncName)
+		w.remove(job.FuncName, job.Name)
+		return nil
+	})
+	w.ran = append(w.ran, fj.funcName)
+	w.tasks[fj.funcName](job)
+}
+
+func (w *fakeWorker) work() {
+	for len(w.queue) > 0 {
+		fj := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.run(fj)
+	}
+}
+
+func add(step string, n int) Handler {
+	return func(ctx context.Context, job StepJob) (interface{}, error) {
+		var v int
+		if err := job.State.Output(step, &v); err != nil {
+			return nil, err
+		}
+		return v + n, nil
+	}
+}
+
+func TestWorkflow(t *testing.T) {
+	store := periodic.NewMemoryResultStore()
+	wf := New("test", store)
+	wf.Step("a", func(ctx context.Context, job StepJob) (interface{}, error) {
+		var v int
+		if err := job.State.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v * 2, nil
+	})
+	wf.Step("b", add("a", 1), "a")
+	wf.Step("c", add("a", 2), "a")
+	wf.Step("d", func(ctx context.Context, job StepJob) (interface{}, error) {
+		var b, c int
+		job.State.Output("b", &b)
+		job.State.Output("c", &c)
+		return b + c, nil
+	}, "b", "c")
+	w := newFakeWorker(wf)
+	if err := wf.Register(w); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wf.Status("run"); err != ErrRunNotFound {
+		t.Fatalf("except %v, got %v", ErrRunNotFound, err)
+	}
+	if err := wf.Start(w, "run", 10); err != nil {
+		t.Fatal(err)
+	}
+	w.work()
+
+	// c submit d before b is done, the job is dropped
+	if got := strings.Join(w.ran, ","); got != "test.a,test.c,test.d,test.b,test.d" {
+		t.Fatalf("got run %s", got)
+	}
+	if len(w.locks) != 0 {
+		t.Fatalf("locks not released: %v", w.locks)
+	}
+	status, err := wf.Status("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != periodic.ResultDone {
+		t.Fatalf("got status %+v", status)
+	}
+	if d := status.Steps["d"]; string(d.Output) != "43" || d.Func != "test.d" || d.Name != "run" {
+		t.Fatalf("d: got %+v", d)
+	}
+
+	// a fan-in step run once when submitted again
+	w.SubmitJob("test.d", "run", map[string]interface{}{"args": []byte(`{"id":"run"}`)})
+	w.ran = nil
+	w.work()
+	if got := strings.Join(w.ran, ","); got != "test.d" || w.acks[len(w.acks)-1] != "done:test.d" {
+		t.Fatalf("got run %s", got)
+	}
+	if status, _ := wf.Status("run"); status.Status != periodic.ResultDone {
+		t.Fatalf("got status %+v", status)
+	}
+}
+
+// hookStore call hook after the first load of a record.
+type hookStore struct {
+	periodic.ResultStore
+	name string
+	hook func()
+}
+
+func (s *hookStore) Load(funcName, name string) (periodic.JobResult, error) {
+	result, err := s.ResultStore.Load(funcName, name)
+	if name == s.name && s.hook != nil {
+		hook := s.hook
+		s.hook = nil
+		hook()
+	}
+	return result, err
+}
+
+func TestWorkflowJoinConcurrent(t *testing.T) {
+	store := &hookStore{ResultStore: periodic.NewMemoryResultStore(), name: "run/a"}
+	wf := New("test", store)
+	wf.Step("a", func(ctx context.Context, job StepJob) (interface{}, error) { return 1, nil })
+	wf.Step("b", func(ctx context.Context, job StepJob) (interface{}, error) { return 2, nil })
+	wf.Step("c", func(ctx context.Context, job StepJob) (interface{}, error) {
+		var a, b int
+		job.State.Output("a", &a)
+		job.State.Output("b", &b)
+		return a + b, nil
+	}, "a", "b")
+	w := newFakeWorker(wf)
+	wf.Register(w)
+	wf.Start(w, "run", nil)
+
+	// the job of c submitted by b read the status of a, then a is done and
+	// submit c before the job is acknowledged
+	store.hook = func() {
+		fj, ok := w.take("test.a")
+		if !ok {
+			t.Fatal("a is not queued")
+		}
+		w.run(fj)
+	}
+	w.work()
+
+	// a wait the lock of c, and run again to submit c once it is released
+	if got := strings.Join(w.ran, ","); got != "test.b,test.c,test.a,test.a,test.c" {
+		t.Fatalf("got run %s", got)
+	}
+	status, err := wf.Status("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != periodic.ResultDone || string(status.Steps["c"].Output) != "3" {
+		t.Fatalf("got status %+v", status)
+	}
+	if len(w.locks) != 0 || len(w.waiting) != 0 {
+		t.Fatalf("locks not released: %v %v", w.locks, w.waiting)
+	}
+}
+
+func TestWorkflowRunning(t *testing.T) {
+	wf := New("test", periodic.NewMemoryResultStore())
+	calls := 0
+	wf.Step("a", func(ctx context.Context, job StepJob) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, periodic.SchedLater(10)
+		}
+		return nil, nil
+	})
+	w := newFakeWorker(wf)
+	wf.Register(w)
+
+	// sched later by the handler, the job run again
+	wf.Start(w, "run", nil)
+	w.work()
+	if status, _ := wf.Status("run"); status.Status != Running || status.Steps["a"].Status != Waiting {
+		t.Fatalf("got status %+v", status)
+	}
+
+	// delivered again while the step is running
+	wf.save("run", "a", periodic.JobResult{Status: Running, StartedAt: time.Now()})
+	wf.Start(w, "run", nil)
+	w.work()
+	if calls != 1 || strings.Join(w.acks, ",") != "later:test.a,later:test.a" {
+		t.Fatalf("got %d calls, acks %v", calls, w.acks)
+	}
+
+	// the step is running for the running timeout
+	wf.SetRunningTimeout(0)
+	wf.Start(w, "run", nil)
+	w.work()
+	if status, _ := wf.Status("run"); calls != 2 || status.Status != periodic.ResultDone {
+		t.Fatalf("got %d calls, status %+v", calls, status)
+	}
+}
+
+func TestWorkflowFail(t *testing.T) {
+	wf := New("test", periodic.NewMemoryResultStore())
+	wf.Step("a", func(ctx context.Context, job StepJob) (interface{}, error) {
+		return nil, errors.New("bad step")
+	})
+	wf.Step("b", add("a", 1), "a")
+	w := newFakeWorker(wf)
+	wf.Register(w)
+	wf.Start(w, "run", nil)
+	w.work()
+	status, err := wf.Status("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != periodic.ResultFail || status.Steps["a"].Error != "bad step" || status.Steps["b"].Status != Pending {
+		t.Fatalf("got status %+v", status)
+	}
+	if got := strings.Join(w.acks, ","); got != "fail:test.a" {
+		t.Fatalf("got acks %s", got)
+	}
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	nop := func(ctx context.Context, job StepJob) (interface{}, error) { return nil, nil }
+	if err := New("test", nil).Validate(); err == nil {
+		t.Fatal("except no step error")
+	}
+	wf := New("test", nil).Step("a", nop, "b")
+	if err := wf.Validate(); err == nil || !strings.Contains(err.Error(), "unknown step b") {
+		t.Fatalf("except unknown step error, got %v", err)
+	}
+	wf = New("test", nil).Step("a", nop, "c").Step("b", nop, "a").Step("c", nop, "b")
+	if err := wf.Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("except cycle error, got %v", err)
+	}
+}